@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/SirYadav1/flashscan-go/pkg/queuescanner"
+)
+
+var coordinatorCmd = &cobra.Command{
+	Use:   "coordinator [flags] -- <command> [command flags]",
+	Short: "Hand out targets in batches to workers running a scan command.",
+	Long: `Hold the target list and hand it out in batches to "flashscan-go worker"
+processes, which run the given scan command on them. Results are collected,
+written and displayed here. Batches of workers that stop sending heartbeats
+are handed to other workers.`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  runCoordinator,
+}
+
+var workerCmd = &cobra.Command{
+	Use:   "worker",
+	Short: "Scan batches of targets handed out by a coordinator.",
+	Args:  cobra.NoArgs,
+	Run:   runWorker,
+}
+
+var (
+	coordinatorFlagListen    string
+	coordinatorFlagFilename  string
+	coordinatorFlagCIDR      string
+	coordinatorFlagOutput    string
+	coordinatorFlagBatchSize int
+	coordinatorFlagLease     float64
+	coordinatorFlagToken     string
+
+	workerFlagCoordinator string
+	workerFlagToken       string
+	workerFlagID          string
+)
+
+// coordinatorClient is set while the worker command runs a scan command
+var coordinatorClient *queuescanner.CoordinatorClient
+
+// jobLocalFlags choose the targets and outputs, or are specific to one
+// process; they are set on the coordinator or worker command line instead of
+// in the job
+var jobLocalFlags = []string{
+	"filename", "cidr", "proxy", "output", "failures-output", "resume",
+	"shard", "order", "seed", "metrics-listen", "control-listen",
+}
+
+func init() {
+	rootCmd.AddCommand(coordinatorCmd, workerCmd)
+
+	coordinatorCmd.Flags().StringVar(&coordinatorFlagListen, "listen", "127.0.0.1:7070", "address to serve workers on")
+	coordinatorCmd.Flags().StringVarP(&coordinatorFlagFilename, "filename", "f", "", "target list filename (default: stdin unless --cidr is set)")
+	coordinatorCmd.Flags().StringVarP(&coordinatorFlagCIDR, "cidr", "c", "", "cidr to scan e.g. 104.16.0.0/24")
+	coordinatorCmd.Flags().StringVarP(&coordinatorFlagOutput, "output", "o", "", "output result")
+	coordinatorCmd.Flags().IntVar(&coordinatorFlagBatchSize, "batch-size", queuescanner.DefaultBatchSize, "targets handed to a worker at once")
+	coordinatorCmd.Flags().Float64Var(&coordinatorFlagLease, "lease", queuescanner.DefaultLease.Seconds(), "seconds without a heartbeat before a worker's batches go to other workers")
+	coordinatorCmd.Flags().StringVar(&coordinatorFlagToken, "token", "", "shared secret workers must present")
+
+	workerCmd.Flags().StringVar(&workerFlagCoordinator, "coordinator", "http://127.0.0.1:7070", "coordinator URL")
+	workerCmd.Flags().StringVar(&workerFlagToken, "token", "", "shared secret set on the coordinator")
+	workerCmd.Flags().StringVar(&workerFlagID, "id", "", "worker name shown to the coordinator (default: host-pid)")
+}
+
+// parseJob parses the job arguments as flags of its scan command
+func parseJob(job queuescanner.Job) (*cobra.Command, []queuescanner.Column, error) {
+	scanCmd, columns, err := parseScanCommand(job.Command, job.Args)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, name := range jobLocalFlags {
+		if scanCmd.Flags().Changed(name) {
+			return nil, nil, fmt.Errorf("--%s cannot be part of the job; set it on the coordinator or worker", name)
+		}
+	}
+	return scanCmd, columns, nil
+}
+
+// changedFlags returns the flags given on the command line of cmd
+func changedFlags(cmd *cobra.Command) map[string]string {
+	flags := make(map[string]string)
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		flags[f.Name] = f.Value.String()
+	})
+	return flags
+}
+
+func runCoordinator(cmd *cobra.Command, args []string) {
+	if globalFlagResume != "" {
+		fatal(fmt.Errorf("--resume is not supported by the coordinator"))
+	}
+
+	job := queuescanner.Job{Command: args[0], Args: args[1:]}
+
+	// Parsing the job sets the global flags too; keep those of the coordinator
+	saved := make(map[*pflag.Flag]string)
+	rootCmd.PersistentFlags().VisitAll(func(f *pflag.Flag) {
+		saved[f] = f.Value.String()
+	})
+	scanCmd, columns, err := parseJob(job)
+	if err != nil {
+		fatal(err)
+	}
+	for f, value := range saved {
+		if err := f.Value.Set(value); err != nil {
+			fatal(err)
+		}
+	}
+
+	var sources []queuescanner.TargetSource
+	if coordinatorFlagFilename != "" || coordinatorFlagCIDR == "" {
+		lines, err := openTargetFile(coordinatorFlagFilename)
+		if err != nil {
+			fatal(err)
+		}
+		sources = append(sources, lines)
+	}
+	if coordinatorFlagCIDR != "" {
+		cidrHosts, err := queuescanner.NewCIDRSource(coordinatorFlagCIDR)
+		if err != nil {
+			fatal(err)
+		}
+		sources = append(sources, cidrHosts)
+	}
+	targets := queuescanner.NewCompositeSource(sources...)
+
+	qs := newQueueScanner(cmd, nil)
+	if scanCmd == sniCmd {
+		targets = applySNIDeep(qs, targets)
+		if err := applySNIConnect(qs); err != nil {
+			fatal(err)
+		}
+	}
+	qs.SetColumns(columns...)
+	qs.SetOptions(targets, coordinatorFlagOutput, globalFlagStatInterval)
+
+	if coordinatorFlagToken == "" {
+		if host, _, err := net.SplitHostPort(coordinatorFlagListen); err == nil {
+			if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+				fmt.Fprintf(os.Stderr, "warning: %s is reachable from other hosts and no --token is set\n", coordinatorFlagListen)
+			}
+		}
+	}
+
+	summary := qs.StartCoordinator(coordinatorFlagListen, queuescanner.CoordinatorOptions{
+		Job:       job,
+		BatchSize: coordinatorFlagBatchSize,
+		Lease:     time.Duration(coordinatorFlagLease * float64(time.Second)),
+		Token:     coordinatorFlagToken,
+	})
+	if summary.Err != nil {
+		fatal(summary.Err)
+	}
+}
+
+func runWorker(cmd *cobra.Command, args []string) {
+	if globalFlagResume != "" {
+		fatal(fmt.Errorf("--resume is not supported by workers"))
+	}
+
+	id := workerFlagID
+	if id == "" {
+		host, _ := os.Hostname()
+		id = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+
+	client, err := queuescanner.DialCoordinator(workerFlagCoordinator, workerFlagToken, id)
+	if err != nil {
+		fatal(err)
+	}
+
+	// Flags given to the worker win over those of the job
+	local := changedFlags(cmd)
+	scanCmd, _, err := parseJob(client.Job())
+	if err != nil {
+		fatal(err)
+	}
+	for name, value := range local {
+		if scanCmd.Flags().Lookup(name) == nil {
+			continue
+		}
+		if err := scanCmd.Flags().Set(name, value); err != nil {
+			fatal(err)
+		}
+	}
+
+	coordinatorClient = client
+	scanCmd.Run(scanCmd, nil)
+}
@@ -0,0 +1,287 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/SirYadav1/flashscan-go/pkg/queuescanner"
+)
+
+// recordHeaderLen is the length of a TLS record header: type, version and
+// length
+const recordHeaderLen = 5
+
+// fragmentFlags configure the ClientHello fragmentation of a scan command
+type fragmentFlags struct {
+	mode  string
+	size  int
+	sni   string
+	delay int
+}
+
+func (f *fragmentFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.mode, "fragment", "off", "split the ClientHello: off, tcp (into TCP segments) or record (into TLS records); each host is also tried unfragmented")
+	cmd.Flags().IntVar(&f.size, "fragment-size", 0, "bytes per fragment (0 = only split at --fragment-sni)")
+	cmd.Flags().StringVar(&f.sni, "fragment-sni", "middle", "split at the server name: before it, in its middle, or none")
+	cmd.Flags().IntVar(&f.delay, "fragment-delay", 0, "milliseconds to wait between fragments")
+}
+
+// options returns the fragmentation set by the flags, or nil when it is off
+func (f *fragmentFlags) options() (*fragmentOptions, error) {
+	switch f.mode {
+	case "off":
+		return nil, nil
+	case "tcp", "record":
+	default:
+		return nil, fmt.Errorf("unknown --fragment %q (want off, tcp or record)", f.mode)
+	}
+	switch f.sni {
+	case "before", "middle", "none":
+	default:
+		return nil, fmt.Errorf("unknown --fragment-sni %q (want before, middle or none)", f.sni)
+	}
+	if f.size < 0 || f.delay < 0 {
+		return nil, fmt.Errorf("--fragment-size and --fragment-delay must not be negative")
+	}
+
+	return &fragmentOptions{
+		records: f.mode == "record",
+		size:    f.size,
+		sni:     f.sni,
+		delay:   time.Duration(f.delay) * time.Millisecond,
+	}, nil
+}
+
+// fragmentOptions say how to split the ClientHello
+type fragmentOptions struct {
+	records bool // split into TLS records instead of TCP segments
+	size    int
+	sni     string
+	delay   time.Duration
+}
+
+// fragmentColumn shows the outcome of the unfragmented handshake of a hit
+var fragmentColumn = queuescanner.Column{Header: "PLAIN", Width: 16, Value: func(r *queuescanner.Result) string {
+	return r.Fields["handshake_plain"]
+}}
+
+// wrap returns conn, splitting the ClientHello written to it when
+// fragmentation is on. The delay between fragments ends early when ctx, the
+// context of the handshake, is done.
+func (o *fragmentOptions) wrap(ctx context.Context, conn net.Conn) net.Conn {
+	if o == nil {
+		return conn
+	}
+	return &fragmentConn{Conn: conn, ctx: ctx, opts: o}
+}
+
+// fragmentConn splits the first record written, the ClientHello, and passes
+// everything after it through
+type fragmentConn struct {
+	net.Conn
+	ctx  context.Context
+	opts *fragmentOptions
+	sent bool
+}
+
+func (c *fragmentConn) Write(p []byte) (int, error) {
+	if c.sent || len(p) < recordHeaderLen || p[0] != 0x16 {
+		return c.Conn.Write(p)
+	}
+	c.sent = true
+
+	bodyLen := int(p[3])<<8 | int(p[4])
+	if recordHeaderLen+bodyLen > len(p) {
+		return c.Conn.Write(p)
+	}
+	header, body, rest := p[:recordHeaderLen], p[recordHeaderLen:recordHeaderLen+bodyLen], p[recordHeaderLen+bodyLen:]
+	cuts := c.opts.cuts(body)
+
+	var fragments [][]byte
+	if c.opts.records {
+		// Every piece of the handshake message gets a record of its own
+		start := 0
+		for _, cut := range append(cuts, len(body)) {
+			record := append([]byte{header[0], header[1], header[2], byte((cut - start) >> 8), byte(cut - start)}, body[start:cut]...)
+			fragments = append(fragments, record)
+			start = cut
+		}
+		if c.opts.delay == 0 {
+			// Still one TCP write, so only the record layer is split
+			var joined []byte
+			for _, f := range fragments {
+				joined = append(joined, f...)
+			}
+			fragments = [][]byte{joined}
+		}
+	} else {
+		record := p[:recordHeaderLen+bodyLen]
+		start := 0
+		for _, cut := range append(cuts, len(body)) {
+			end := recordHeaderLen + cut
+			fragments = append(fragments, record[start:end])
+			start = end
+		}
+	}
+
+	for i, fragment := range fragments {
+		if i > 0 && c.opts.delay > 0 {
+			timer := time.NewTimer(c.opts.delay)
+			select {
+			case <-timer.C:
+			case <-c.ctx.Done():
+				timer.Stop()
+				return 0, c.ctx.Err()
+			}
+		}
+		if _, err := c.Conn.Write(fragment); err != nil {
+			return 0, err
+		}
+	}
+	if len(rest) > 0 {
+		if _, err := c.Conn.Write(rest); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// cuts returns the offsets in the ClientHello message body to split at, in
+// order, excluding 0 and len(body)
+func (o *fragmentOptions) cuts(body []byte) []int {
+	set := make(map[int]bool)
+	if start, length, ok := serverNameOffset(body); ok {
+		switch o.sni {
+		case "before":
+			set[start] = true
+		case "middle":
+			set[start+length/2] = true
+		}
+	}
+	if o.size > 0 {
+		for cut := o.size; cut < len(body); cut += o.size {
+			set[cut] = true
+		}
+	}
+	if len(set) == 0 {
+		// No server name to split at and no size, split in half
+		set[len(body)/2] = true
+	}
+
+	var cuts []int
+	for cut := range set {
+		if cut > 0 && cut < len(body) {
+			cuts = append(cuts, cut)
+		}
+	}
+	sort.Ints(cuts)
+	return cuts
+}
+
+// serverNameOffset finds the host name of the server_name extension in a
+// ClientHello message
+func serverNameOffset(msg []byte) (start, length int, ok bool) {
+	// type (1), length (3), version (2), random (32)
+	pos := 1 + 3 + 2 + 32
+	skip := func(lenBytes int) bool {
+		if pos+lenBytes > len(msg) {
+			return false
+		}
+		n := 0
+		for _, b := range msg[pos : pos+lenBytes] {
+			n = n<<8 | int(b)
+		}
+		pos += lenBytes + n
+		return pos <= len(msg)
+	}
+	// session id, cipher suites, compression methods
+	if len(msg) < pos || msg[0] != 0x01 || !skip(1) || !skip(2) || !skip(1) {
+		return 0, 0, false
+	}
+
+	if pos+2 > len(msg) {
+		return 0, 0, false
+	}
+	end := min(pos+2+(int(msg[pos])<<8|int(msg[pos+1])), len(msg))
+	pos += 2
+	for pos+4 <= end {
+		extType := int(msg[pos])<<8 | int(msg[pos+1])
+		extLen := int(msg[pos+2])<<8 | int(msg[pos+3])
+		pos += 4
+		if extType == 0 {
+			// list length (2), name type (1), name length (2), name
+			if extLen < 5 || pos+5 > end {
+				return 0, 0, false
+			}
+			length = int(msg[pos+3])<<8 | int(msg[pos+4])
+			start = pos + 5
+			if start+length > end {
+				return 0, 0, false
+			}
+			return start, length, true
+		}
+		pos += extLen
+	}
+	return 0, 0, false
+}
+
+// fragmentCheck is the outcome of an unfragmented handshake made next to a
+// fragmented probe, nil when fragmentation is off
+type fragmentCheck struct {
+	plainErr error
+}
+
+// comparePlain handshakes with address without fragmentation
+func (o *fragmentOptions) comparePlain(ctx context.Context, address string, cfg *tls.Config, timeout time.Duration) *fragmentCheck {
+	if o == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// A full handshake, not one resuming the session of the probe
+	cfg = cfg.Clone()
+	cfg.ClientSessionCache = nil
+
+	dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: timeout}, Config: cfg}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return &fragmentCheck{plainErr: err}
+	}
+	conn.Close()
+	return &fragmentCheck{}
+}
+
+// failure tags the error of a failed fragmented handshake, saying whether
+// the plain one succeeds
+func (c *fragmentCheck) failure(err error) error {
+	if c == nil {
+		return queuescanner.Fail(queuescanner.FailureTLSHandshake, err)
+	}
+	if c.plainErr == nil {
+		err = fmt.Errorf("fragmented handshake failed, plain handshake succeeds: %w", err)
+	} else {
+		err = fmt.Errorf("fragmented handshake failed, plain handshake fails too: %w", err)
+	}
+	return queuescanner.Fail(queuescanner.FailureTLSHandshake, err)
+}
+
+// report records both handshakes in the fields of a hit
+func (c *fragmentCheck) report(res *queuescanner.Result) {
+	if c == nil {
+		return
+	}
+	plain := "ok"
+	if c.plainErr != nil {
+		plain = queuescanner.ClassifyError(c.plainErr).String()
+	}
+	res.SetField("handshake_plain", plain)
+	res.SetField("handshake_fragmented", "ok")
+}
@@ -0,0 +1,276 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/SirYadav1/flashscan-go/pkg/queuescanner"
+)
+
+var pipelineCmd = &cobra.Command{
+	Use:   "pipeline",
+	Short: "Chain scan commands, feeding each stage's hits into the next.",
+	Long: `Run scan commands as stages of a pipeline: the hosts each stage reports
+as hits become the targets of the next, e.g. ping, then sni, then direct.
+Stages are given with --stage or in a --file, and run one after the other or,
+with --stream, all at once.
+
+The first stage reads its targets as usual (-f, --cidr, stdin); the others
+read from the stage before. Global flags apply to every stage unless a stage
+sets them itself.`,
+	Args: cobra.NoArgs,
+	Run:  runPipeline,
+}
+
+var (
+	pipelineFlagStages []string
+	pipelineFlagFile   string
+	pipelineFlagStream bool
+)
+
+// pipelineFile is the layout of a --file
+type pipelineFile struct {
+	Stream bool                `json:"stream"`
+	Stages []pipelineStageSpec `json:"stages"`
+}
+
+// pipelineStageSpec is one stage: a scan command and its flags, written
+// like the flags of a profile
+type pipelineStageSpec struct {
+	Name    string                      `json:"name,omitempty"`
+	Command string                      `json:"command"`
+	Flags   map[string]profileFlagValue `json:"flags,omitempty"`
+	args    []string
+}
+
+// stageBuild collects the scanner configured by a scan command instead of
+// running it, while the pipeline is set up
+type stageBuild struct {
+	input queuescanner.TargetSource // targets from the stage before, nil for the first
+	qs    *queuescanner.QueueScanner
+}
+
+// pipelineBuild is set while a pipeline stage is being configured
+var pipelineBuild *stageBuild
+
+// pipelineInputFlags choose the targets, which only the first stage may do
+var pipelineInputFlags = []string{"filename", "cidr", "proxy"}
+
+// pipelineUnsupportedFlags cannot be set per stage
+var pipelineUnsupportedFlags = []string{"resume", "metrics-listen", "control-listen", "ui"}
+
+func init() {
+	rootCmd.AddCommand(pipelineCmd)
+
+	pipelineCmd.Flags().StringArrayVar(&pipelineFlagStages, "stage", nil, `a stage as "command [flags]", e.g. "ping -f hosts.txt --port 443"; repeat in order`)
+	pipelineCmd.Flags().StringVar(&pipelineFlagFile, "file", "", "read the stages from this JSON file")
+	pipelineCmd.Flags().BoolVar(&pipelineFlagStream, "stream", false, "run all stages at once, passing hits on as they are found")
+}
+
+// loadPipelineFile reads the stages of a --file
+func loadPipelineFile(path string) (*pipelineFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file pipelineFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	for i := range file.Stages {
+		stage := &file.Stages[i]
+		for _, name := range sortedFlagNames(Profile{Flags: stage.Flags}) {
+			stage.args = append(stage.args, "--"+name+"="+string(stage.Flags[name]))
+		}
+	}
+	return &file, nil
+}
+
+// splitArgs splits a --stage into words like a POSIX shell would, honouring
+// single quotes, double quotes and backslashes
+func splitArgs(s string) ([]string, error) {
+	var (
+		args    []string
+		word    strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	for _, c := range s {
+		switch {
+		case escaped:
+			word.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote, inWord = c, true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", s)
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
+
+// pipelineStages returns the stages from --file and --stage, and whether to
+// stream
+func pipelineStages(cmd *cobra.Command) ([]pipelineStageSpec, bool, error) {
+	var stages []pipelineStageSpec
+	stream := pipelineFlagStream
+
+	if pipelineFlagFile != "" {
+		file, err := loadPipelineFile(pipelineFlagFile)
+		if err != nil {
+			return nil, false, err
+		}
+		stages = file.Stages
+		if !cmd.Flags().Changed("stream") {
+			stream = file.Stream
+		}
+	}
+
+	for _, stage := range pipelineFlagStages {
+		words, err := splitArgs(stage)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(words) == 0 {
+			return nil, false, fmt.Errorf("empty --stage")
+		}
+		stages = append(stages, pipelineStageSpec{Command: words[0], args: words[1:]})
+	}
+
+	if len(stages) == 0 {
+		return nil, false, fmt.Errorf("no stages: give --stage or --file")
+	}
+	return stages, stream, nil
+}
+
+func runPipeline(cmd *cobra.Command, args []string) {
+	if globalFlagResume != "" {
+		fatal(fmt.Errorf("--resume is not supported by the pipeline"))
+	}
+
+	stages, stream, err := pipelineStages(cmd)
+	if err != nil {
+		fatal(err)
+	}
+
+	renderer, err := queuescanner.NewRenderer(globalFlagUI)
+	if err != nil {
+		fatal(err)
+	}
+	pipeline := queuescanner.NewPipeline(renderer, stream)
+
+	// Stages may set global flags for themselves; start each from those of
+	// the pipeline command line
+	type savedFlag struct {
+		value   string
+		changed bool
+	}
+	saved := make(map[*pflag.Flag]savedFlag)
+	rootCmd.PersistentFlags().VisitAll(func(f *pflag.Flag) {
+		saved[f] = savedFlag{f.Value.String(), f.Changed}
+	})
+	restore := func(changed bool) {
+		for f, s := range saved {
+			f.Value.Set(s.value)
+			f.Changed = changed && s.changed
+		}
+	}
+	defer restore(true)
+
+	names := make(map[string]bool)
+	commands := make(map[string]bool)
+	for i, stage := range stages {
+		fail := func(err error) {
+			fatal(fmt.Errorf("stage %d (%s): %w", i+1, stage.Command, err))
+		}
+
+		if commands[stage.Command] {
+			// The scan functions read the flags of their command while scanning
+			fail(fmt.Errorf("a command can only be used by one stage"))
+		}
+		commands[stage.Command] = true
+
+		// Clear Changed to tell the flags set by the stage from those of the
+		// pipeline
+		restore(false)
+		scanCmd, _, err := parseScanCommand(stage.Command, stage.args)
+		if err != nil {
+			fatal(fmt.Errorf("stage %d: %w", i+1, err))
+		}
+		for _, name := range pipelineUnsupportedFlags {
+			if scanCmd.Flags().Changed(name) {
+				fail(fmt.Errorf("--%s cannot be set per stage", name))
+			}
+		}
+		for f, s := range saved {
+			f.Changed = f.Changed || s.changed
+		}
+
+		build := &stageBuild{}
+		var input *queuescanner.Pipe
+		if i > 0 {
+			for _, name := range pipelineInputFlags {
+				if scanCmd.Flags().Changed(name) {
+					fail(fmt.Errorf("--%s: only the first stage reads targets", name))
+				}
+			}
+			input = queuescanner.NewPipe()
+			build.input = input
+			if scanCmd.Flags().Lookup("filename") != nil {
+				// Commands that only scan a list when given one
+				scanCmd.Flags().Set("filename", "-")
+			}
+		}
+
+		pipelineBuild = build
+		scanCmd.Run(scanCmd, nil)
+		pipelineBuild = nil
+		if build.qs == nil {
+			fail(fmt.Errorf("no scan configured"))
+		}
+
+		name := stage.Name
+		if name == "" {
+			name = stage.Command
+		}
+		if names[name] {
+			fail(fmt.Errorf("duplicate stage name %q", name))
+		}
+		names[name] = true
+
+		pipeline.AddStage(name, build.qs, input)
+	}
+
+	summary := pipeline.Start()
+	if summary.Err != nil {
+		fatal(summary.Err)
+	}
+}
@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// profileFlagValue is a flag value in the profiles file. Numbers and booleans
+// may be written without quotes.
+type profileFlagValue string
+
+func (v *profileFlagValue) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*v = profileFlagValue(s)
+		return nil
+	}
+
+	var scalar any
+	if err := json.Unmarshal(data, &scalar); err != nil {
+		return err
+	}
+	switch scalar.(type) {
+	case float64, bool:
+		*v = profileFlagValue(data)
+		return nil
+	}
+	return fmt.Errorf("flag value must be a string, number or boolean, got %s", data)
+}
+
+// Profile is a named set of flags for one command.
+type Profile struct {
+	Description string                      `json:"description,omitempty"`
+	Flags       map[string]profileFlagValue `json:"flags"`
+}
+
+// Profiles maps a command name to its profiles by name.
+type Profiles map[string]map[string]Profile
+
+var profilesCmd = &cobra.Command{
+	Use:   "profiles",
+	Short: "List and show scan profiles from the profiles file.",
+}
+
+var profilesListCmd = &cobra.Command{
+	Use:   "list [command]",
+	Short: "List profiles, optionally only those of one command.",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runProfilesList,
+}
+
+var profilesShowCmd = &cobra.Command{
+	Use:   "show <command> <name>",
+	Short: "Show the flags of a profile.",
+	Args:  cobra.ExactArgs(2),
+	RunE:  runProfilesShow,
+}
+
+func init() {
+	rootCmd.AddCommand(profilesCmd)
+	profilesCmd.AddCommand(profilesListCmd, profilesShowCmd)
+}
+
+// defaultProfileFile returns ~/.config/flashscan-go/profiles.json, or the
+// platform's equivalent
+func defaultProfileFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "flashscan-go", "profiles.json")
+}
+
+// profileFile returns --profile-file, or the default location
+func profileFile() string {
+	if globalFlagProfileFile != "" {
+		return globalFlagProfileFile
+	}
+	return defaultProfileFile()
+}
+
+// loadProfiles reads the profiles file. The returned error wraps
+// fs.ErrNotExist when there is none.
+func loadProfiles(path string) (Profiles, error) {
+	if path == "" {
+		return nil, fmt.Errorf("no profiles file: set --profile-file")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var profiles Profiles
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return profiles, nil
+}
+
+// applyProfile sets every flag of the --profile for this command that was
+// not given on the command line or restored by --resume.
+func applyProfile(cmd *cobra.Command, args []string) error {
+	if globalFlagProfile == "" {
+		return nil
+	}
+
+	path := profileFile()
+	profiles, err := loadProfiles(path)
+	if err != nil {
+		return fmt.Errorf("reading profiles: %w", err)
+	}
+
+	profile, ok := profiles[cmd.Name()][globalFlagProfile]
+	if !ok {
+		return fmt.Errorf("no %q profile for the %s command in %s", globalFlagProfile, cmd.Name(), path)
+	}
+
+	for _, name := range sortedFlagNames(profile) {
+		if name == "profile" || name == "profile-file" {
+			return fmt.Errorf("profile %q: --%s cannot be set by a profile", globalFlagProfile, name)
+		}
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil {
+			return fmt.Errorf("profile %q: unknown flag --%s for %s", globalFlagProfile, name, cmd.Name())
+		}
+		if flag.Changed {
+			continue
+		}
+		if err := cmd.Flags().Set(name, string(profile.Flags[name])); err != nil {
+			return fmt.Errorf("profile %q: --%s: %w", globalFlagProfile, name, err)
+		}
+	}
+	return nil
+}
+
+func sortedFlagNames(profile Profile) []string {
+	names := make([]string, 0, len(profile.Flags))
+	for name := range profile.Flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func runProfilesList(cmd *cobra.Command, args []string) error {
+	path := profileFile()
+	profiles, err := loadProfiles(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "no profiles file at %s\n", path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	commands := make([]string, 0, len(profiles))
+	for command := range profiles {
+		if len(args) == 0 || args[0] == command {
+			commands = append(commands, command)
+		}
+	}
+	sort.Strings(commands)
+
+	for _, command := range commands {
+		names := make([]string, 0, len(profiles[command]))
+		for name := range profiles[command] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			fmt.Printf("%-10s %-20s %s\n", command, name, profiles[command][name].Description)
+		}
+	}
+	return nil
+}
+
+func runProfilesShow(cmd *cobra.Command, args []string) error {
+	command, name := args[0], args[1]
+
+	path := profileFile()
+	profiles, err := loadProfiles(path)
+	if err != nil {
+		return err
+	}
+	profile, ok := profiles[command][name]
+	if !ok {
+		return fmt.Errorf("no %q profile for the %s command in %s", name, command, path)
+	}
+
+	if profile.Description != "" {
+		fmt.Printf("# %s\n", profile.Description)
+	}
+	line := []string{"flashscan-go", command}
+	for _, flag := range sortedFlagNames(profile) {
+		line = append(line, "--"+flag+"="+shellQuote(string(profile.Flags[flag])))
+	}
+	fmt.Println(strings.Join(line, " "))
+	return nil
+}
+
+// shellQuote single-quotes s for a POSIX shell unless it only holds safe
+// characters
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:,=@") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
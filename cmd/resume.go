@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/SirYadav1/flashscan-go/pkg/queuescanner"
+)
+
+// resumeCheckpoint is the state loaded from --resume, nil on a fresh start
+var resumeCheckpoint *queuescanner.Checkpoint
+
+// restoreResumeFlags loads the --resume state file, if it exists, and
+// re-applies every flag of the interrupted run that was not given again on
+// the command line.
+func restoreResumeFlags(cmd *cobra.Command, args []string) error {
+	if globalFlagResume == "" {
+		return nil
+	}
+
+	cp, err := queuescanner.LoadCheckpoint(globalFlagResume)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading resume state: %w", err)
+	}
+
+	if cp.Command != cmd.Name() {
+		return fmt.Errorf("resume state %s was written by the %q command, not %q", globalFlagResume, cp.Command, cmd.Name())
+	}
+
+	for name, value := range cp.Flags {
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil || flag.Changed {
+			continue
+		}
+		if err := cmd.Flags().Set(name, value); err != nil {
+			return fmt.Errorf("restoring --%s from resume state: %w", name, err)
+		}
+	}
+
+	resumeCheckpoint = cp
+	return nil
+}
+
+// resumeFlags returns the flags set for this run, to be stored in the state file
+func resumeFlags(cmd *cobra.Command) map[string]string {
+	flags := make(map[string]string)
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if f.Name != "resume" {
+			flags[f.Name] = f.Value.String()
+		}
+	})
+	return flags
+}
@@ -8,11 +8,41 @@ var rootCmd = &cobra.Command{
 	Use:   "flashscan-go",
 	Short: "FlashScan - High Performance Network Scanner",
 	Long:  "FlashScan - High Performance Network Scanner by SirYadav1",
+
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// Flags on the command line win over --resume, which wins over --profile
+		if err := restoreResumeFlags(cmd, args); err != nil {
+			return err
+		}
+		return applyProfile(cmd, args)
+	},
 }
 
 var (
-	globalFlagThreads      int
-	globalFlagStatInterval float64
+	globalFlagThreads        int
+	globalFlagStatInterval   float64
+	globalFlagGracePeriod    float64
+	globalFlagResume         string
+	globalFlagProfile        string
+	globalFlagProfileFile    string
+	globalFlagRate           float64
+	globalFlagBurst          int
+	globalFlagAutoThreads    bool
+	globalFlagMinThreads     int
+	globalFlagMaxThreads     int
+	globalFlagOutputFormat   string
+	globalFlagUI             string
+	globalFlagFailuresOutput string
+	globalFlagRetries        int
+	globalFlagRetryBackoff   float64
+	globalFlagMetricsListen  string
+	globalFlagControlListen  string
+	globalFlagNormalize      bool
+	globalFlagDedup          bool
+	globalFlagDedupMemory    int
+	globalFlagOrder          string
+	globalFlagSeed           uint64
+	globalFlagShard          string
 )
 
 func Execute() {
@@ -53,4 +83,26 @@ func init() {
 	rootCmd.SetHelpCommand(&cobra.Command{Hidden: true})
 	rootCmd.PersistentFlags().IntVarP(&globalFlagThreads, "threads", "t", 64, "total threads to use")
 	rootCmd.PersistentFlags().Float64Var(&globalFlagStatInterval, "stat-interval", 1.0, "stat interval in seconds")
+	rootCmd.PersistentFlags().Float64Var(&globalFlagGracePeriod, "grace-period", 5.0, "seconds to wait for in-flight scans after interrupt")
+	rootCmd.PersistentFlags().StringVar(&globalFlagResume, "resume", "", "state file to save progress to and resume an interrupted scan from")
+	rootCmd.PersistentFlags().StringVar(&globalFlagProfile, "profile", "", "apply the flags of this named profile for the command; explicit flags override it")
+	rootCmd.PersistentFlags().StringVar(&globalFlagProfileFile, "profile-file", "", "profiles file (default ~/.config/flashscan-go/profiles.json)")
+	rootCmd.PersistentFlags().Float64Var(&globalFlagRate, "rate", 0, "max new connections per second across all threads (0 = unlimited)")
+	rootCmd.PersistentFlags().IntVar(&globalFlagBurst, "burst", 0, "connections allowed at once above --rate (default: one second's worth)")
+	rootCmd.PersistentFlags().BoolVar(&globalFlagAutoThreads, "auto-threads", false, "tune threads automatically, backing off when timeouts rise")
+	rootCmd.PersistentFlags().IntVar(&globalFlagMinThreads, "min-threads", 4, "lower bound for --auto-threads")
+	rootCmd.PersistentFlags().IntVar(&globalFlagMaxThreads, "max-threads", 512, "upper bound for --auto-threads")
+	rootCmd.PersistentFlags().StringVar(&globalFlagOutputFormat, "output-format", "text", "output file format: text, jsonl or csv")
+	rootCmd.PersistentFlags().StringVar(&globalFlagUI, "ui", "auto", "progress display: auto, tty, line (progress on stderr) or silent")
+	rootCmd.PersistentFlags().StringVar(&globalFlagFailuresOutput, "failures-output", "", "write failed targets with their failure class to this file")
+	rootCmd.PersistentFlags().IntVar(&globalFlagRetries, "retries", 0, "retry targets failing with a timeout, reset or temporary DNS error up to this many times")
+	rootCmd.PersistentFlags().Float64Var(&globalFlagRetryBackoff, "retry-backoff", 1.0, "seconds to wait before the first retry, doubled for each further retry")
+	rootCmd.PersistentFlags().StringVar(&globalFlagMetricsListen, "metrics-listen", "", "serve Prometheus metrics on this address (e.g. :9090) at /metrics")
+	rootCmd.PersistentFlags().BoolVar(&globalFlagNormalize, "normalize", false, "clean up input lines: strip comments, URLs and ports, lowercase and punycode-encode hostnames")
+	rootCmd.PersistentFlags().BoolVar(&globalFlagDedup, "dedup", false, "skip hosts that were already queued (needs --normalize)")
+	rootCmd.PersistentFlags().IntVar(&globalFlagDedupMemory, "dedup-memory", 0, "cap --dedup memory in MiB for huge lists, at the cost of rare false duplicates (0 = exact)")
+	rootCmd.PersistentFlags().StringVar(&globalFlagOrder, "order", "sequential", "scan order: sequential, random or interleave (spread across subnets and domains)")
+	rootCmd.PersistentFlags().Uint64Var(&globalFlagSeed, "seed", 0, "seed for --order random and interleave, to repeat the same order (default: random)")
+	rootCmd.PersistentFlags().StringVar(&globalFlagShard, "shard", "", "scan only shard i of n (e.g. 2/4), split by a stable hash of each target")
+	rootCmd.PersistentFlags().StringVar(&globalFlagControlListen, "control-listen", "", "serve the HTTP/JSON control API on a loopback address (127.0.0.1:port) or unix:/path")
 }
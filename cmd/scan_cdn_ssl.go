@@ -4,8 +4,10 @@ import (
 	"bufio"
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -36,8 +38,24 @@ var (
 	cdnSSLFlagPayload           string
 	cdnSSLFlagTimeout           int
 	cdnSSLFlagOutput            string
+	cdnSSLFlagVerify            bool
+	cdnSSLFlagCAFile            string
+	cdnSSLFlagValid             bool
+	cdnSSLFlagTLS               tlsFlags
+	cdnSSLFlagFragment          fragmentFlags
 )
 
+var cdnSSLColumns = []queuescanner.Column{queuescanner.ColumnAddress.Named("PROXY ADDRESS"), queuescanner.ColumnResponse.Named("RESPONSE STATUS")}
+
+// cdnSSLVerifier is set by --verify
+var cdnSSLVerifier *certVerifier
+
+// cdnSSLTLSConfig is the ClientHello set by the --tls flags
+var cdnSSLTLSConfig *tls.Config
+
+// cdnSSLFragment is set by --fragment
+var cdnSSLFragment *fragmentOptions
+
 func init() {
 	rootCmd.AddCommand(cdnSSLCmd)
 
@@ -54,9 +72,32 @@ func init() {
 	cdnSSLCmd.Flags().StringVar(&cdnSSLFlagPayload, "payload", "[method] [path] [protocol][crlf]Host: [host][crlf]Upgrade: websocket[crlf][crlf]", "request payload for sending throught cdn proxy")
 	cdnSSLCmd.Flags().IntVar(&cdnSSLFlagTimeout, "timeout", 3, "handshake timeout")
 	cdnSSLCmd.Flags().StringVarP(&cdnSSLFlagOutput, "output", "o", "", "output result")
+	cdnSSLCmd.Flags().BoolVar(&cdnSSLFlagVerify, "verify", false, "verify the certificate chain and the bug hostname after the handshake and report the outcome")
+	cdnSSLCmd.Flags().StringVar(&cdnSSLFlagCAFile, "ca-file", "", "verify against the CA certificates in this PEM file instead of the system roots (implies --verify)")
+	cdnSSLCmd.Flags().BoolVar(&cdnSSLFlagValid, "require-valid", false, "only count handshakes with a valid certificate as success (implies --verify)")
+	cdnSSLFlagTLS.register(cdnSSLCmd)
+	cdnSSLFlagFragment.register(cdnSSLCmd)
 }
 
-func scanCDNSSL(ctx *queuescanner.Ctx, host string) {
+// cdnSSLResultColumns returns the columns of the cdn-ssl command, with the
+// verification status when --verify is set and the plain handshake with
+// --fragment
+func cdnSSLResultColumns() ([]queuescanner.Column, error) {
+	columns := []queuescanner.Column{cdnSSLColumns[0]}
+	if cdnSSLFlagVerify || cdnSSLFlagCAFile != "" || cdnSSLFlagValid {
+		columns = append(columns, queuescanner.ColumnCertStatus)
+	}
+	if cdnSSLFlagFragment.mode != "off" {
+		columns = append(columns, fragmentColumn)
+	}
+	return append(columns, cdnSSLColumns[1:]...), nil
+}
+
+func scanCDNSSL(ctx *queuescanner.Ctx, host string) error {
+	watch := queuescanner.NewStopwatch()
+	var timing queuescanner.Timing
+	ctx.SetTiming(&timing)
+
 	bug := cdnSSLFlagBug
 	if bug == "" {
 		if ipRegex.MatchString(host) {
@@ -71,47 +112,64 @@ func scanCDNSSL(ctx *queuescanner.Ctx, host string) {
 	}
 
 	// Resolve IP for proxy
-	lookupCtx, lookupCancel := context.WithTimeout(context.Background(), 3*time.Second)
+	lookupCtx, lookupCancel := context.WithTimeout(ctx.Context(), 3*time.Second)
 	defer lookupCancel()
 
 	ipStr, err := ResolveIP(lookupCtx, host)
 	if err != nil {
-		return
+		return err
+	}
+	if lookup := watch.Lap(); ipStr != host {
+		timing.DNS = lookup // IP addresses are not looked up
 	}
 
 	address := net.JoinHostPort(ipStr, strconv.Itoa(cdnSSLFlagProxyPort))
 
-	conn, err := net.DialTimeout("tcp", address, 3*time.Second)
+	dialer := &net.Dialer{Timeout: 3 * time.Second}
+	conn, err := dialer.DialContext(ctx.Context(), "tcp", address)
 	if err != nil {
-		return
+		return err
 	}
 	defer conn.Close()
+	timing.Connect = watch.Lap()
 
-	tlsConn := tls.Client(conn, &tls.Config{
-		ServerName:         bug,
-		InsecureSkipVerify: true,
-	})
-
-	handshakeCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cdnSSLFlagTimeout)*time.Second)
+	timeout := time.Duration(cdnSSLFlagTimeout) * time.Second
+	handshakeCtx, cancel := context.WithTimeout(ctx.Context(), timeout)
 	defer cancel()
 
+	cfg := clientConfig(cdnSSLTLSConfig, bug)
+	tlsConn := tls.Client(cdnSSLFragment.wrap(handshakeCtx, conn), cfg)
+
 	err = tlsConn.HandshakeContext(handshakeCtx)
 	if err != nil {
-		return
+		return cdnSSLFragment.comparePlain(ctx.Context(), address, cfg, timeout).failure(err)
+	}
+	timing.TLS = watch.Lap()
+
+	state := tlsConn.ConnectionState()
+	if err := checkHTTP1(state); err != nil {
+		return err
+	}
+	info := queuescanner.NewTLSInfo(state)
+	if err := cdnSSLVerifier.check(state, bug, info); err != nil {
+		return err
 	}
 
-	timeoutCtx, timeoutCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	timeoutCtx, timeoutCancel := context.WithTimeout(ctx.Context(), 10*time.Second)
 	defer timeoutCancel()
 
-	resultCh := make(chan bool)
+	// The goroutine only reads the response; the result is reported here so
+	// a timed out probe can't also count as a hit
+	resultCh := make(chan probeResult, 1)
 
 	go func() {
 		payload := getScanCDNSSLPayloadDecoded(bug)
 		payload = strings.ReplaceAll(payload, "[host]", cdnSSLFlagTarget)
 		payload = strings.ReplaceAll(payload, "[crlf]", "\r\n")
 
-		_, err = tlsConn.Write([]byte(payload))
+		_, err := tlsConn.Write([]byte(payload))
 		if err != nil {
+			resultCh <- probeResult{err: err}
 			return
 		}
 
@@ -121,7 +179,8 @@ func scanCDNSSL(ctx *queuescanner.Ctx, host string) {
 		buf := bufferPool.Get().([]byte)
 		defer bufferPool.Put(buf)
 		
-		scanner := bufio.NewScanner(tlsConn)
+		response := &firstByteReader{Reader: tlsConn, watch: watch}
+		scanner := bufio.NewScanner(response)
 		scanner.Buffer(buf, 4096) // Use our pooled buffer
 		
 		isPrefix := true
@@ -137,24 +196,61 @@ func scanCDNSSL(ctx *queuescanner.Ctx, host string) {
 			}
 		}
 
-		if len(responseLines) == 0 || !strings.Contains(responseLines[0], " 101 ") {
-			ctx.Log(fmt.Sprintf("%-32s  %s", address, strings.Join(responseLines, " -- ")))
+		if len(responseLines) == 0 {
+			if err := scanner.Err(); err != nil {
+				resultCh <- probeResult{err: err}
+			} else {
+				resultCh <- probeResult{err: errEmptyResponse}
+			}
 			return
 		}
 
-		formatted := fmt.Sprintf("%-32s  %s", address, strings.Join(responseLines, " -- "))
-		ctx.ScanSuccess(formatted)
-		ctx.Log(formatted)
-
-		resultCh <- true
+		timing.FirstByte = response.wait
+
+		statusCode, server, location := extractHTTPHeaders(strings.Join(responseLines, "\n"))
+		res := &queuescanner.Result{
+			Target:   host,
+			IP:       ipStr,
+			Port:     cdnSSLFlagProxyPort,
+			Status:   statusCode,
+			Server:   server,
+			Location: location,
+			Latency:  watch.Elapsed(),
+			Timing:   &timing,
+			TLS:      info,
+		}
+		res.SetField("status_line", responseLines[0])
+		resultCh <- probeResult{res: res}
 	}()
 
+	var probe probeResult
 	select {
-	case <-resultCh:
-		return
+	case probe = <-resultCh:
 	case <-timeoutCtx.Done():
-		return
+		// Unblock the goroutine and wait for it, so it is done with the connection
+		tlsConn.Close()
+		<-resultCh
+		return queuescanner.Fail(queuescanner.FailureReadTimeout, timeoutCtx.Err())
+	}
+	if probe.err != nil {
+		return probe.err
 	}
+
+	res := probe.res
+	if cdnSSLFragment != nil {
+		// Done with this connection; servers may limit connections per client
+		tlsConn.Close()
+		cdnSSLFragment.comparePlain(ctx.Context(), address, cfg, timeout).report(res)
+	}
+
+	if res.Status != 101 {
+		ctx.Log(res)
+		return queuescanner.Fail(queuescanner.FailureUnexpectedStatus, errors.New(res.Fields["status_line"]))
+	}
+
+	ctx.ScanSuccess(res)
+
+	return nil
 }
 
 func getScanCDNSSLPayloadDecoded(bug ...string) string {
@@ -170,33 +266,50 @@ func getScanCDNSSLPayloadDecoded(bug ...string) string {
 }
 
 func runScanCDNSSL(cmd *cobra.Command, args []string) {
-	var proxyHosts []string
+	var sources []queuescanner.TargetSource
 
 	if cdnSSLFlagProxyHost != "" {
-		proxyHosts = append(proxyHosts, cdnSSLFlagProxyHost)
+		sources = append(sources, queuescanner.NewSliceSource([]string{cdnSSLFlagProxyHost}))
 	}
 
 	if cdnSSLFlagProxyHostFilename != "" {
-		lines, err := ReadFile(cdnSSLFlagProxyHostFilename)
+		lines, err := openTargetFile(cdnSSLFlagProxyHostFilename)
 		if err != nil {
 			fatal(err)
 		}
-		proxyHosts = append(proxyHosts, lines...)
+		sources = append(sources, lines)
 	}
 
 	if cdnSSLFlagProxyCIDR != "" {
-		cidrHosts, err := IPsFromCIDR(cdnSSLFlagProxyCIDR)
+		cidrHosts, err := queuescanner.NewCIDRSource(cdnSSLFlagProxyCIDR)
 		if err != nil {
 			fatal(err)
 		}
-		proxyHosts = append(proxyHosts, cidrHosts...)
+		sources = append(sources, cidrHosts)
 	}
 
-	fmt.Printf("%s%-32s  %s%s\n", ColorCyan+ColorBold, "PROXY ADDRESS", "RESPONSE STATUS", ColorReset)
-	fmt.Printf("%s%-32s  %s%s\n", ColorCyan, "-------------", "---------------", ColorReset)
+	proxyHosts := queuescanner.NewCompositeSource(sources...)
+
+	columns, err := cdnSSLResultColumns()
+	if err != nil {
+		fatal(err)
+	}
+	cdnSSLVerifier, err = newCertVerifier(cdnSSLFlagVerify, cdnSSLFlagCAFile, cdnSSLFlagValid)
+	if err != nil {
+		fatal(err)
+	}
+	cdnSSLTLSConfig, err = cdnSSLFlagTLS.httpConfig()
+	if err != nil {
+		fatal(err)
+	}
+	cdnSSLFragment, err = cdnSSLFlagFragment.options()
+	if err != nil {
+		fatal(err)
+	}
 
-	qs := queuescanner.New(globalFlagThreads, scanCDNSSL)
-	fmt.Printf("%s\n\n", getScanCDNSSLPayloadDecoded())
+	qs := newQueueScanner(cmd, scanCDNSSL)
+	qs.SetColumns(columns...)
+	fmt.Fprintf(os.Stderr, "%s\n\n", getScanCDNSSLPayloadDecoded())
 	qs.SetOptions(proxyHosts, cdnSSLFlagOutput, globalFlagStatInterval)
-	qs.Start()
+	runQueueScanner(qs)
 }
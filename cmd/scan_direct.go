@@ -30,8 +30,15 @@ var (
 	directFlagTimeoutConnect int
 	directFlagTimeoutRequest int
 	directFlagTimeoutDNS     int
+	directFlagTLS            tlsFlags
 )
 
+// directTLSConfig is the ClientHello set by the --tls flags, used on the
+// HTTPS ports
+var directTLSConfig *tls.Config
+
+var directColumns = []queuescanner.Column{queuescanner.ColumnIP, queuescanner.ColumnStatus, queuescanner.ColumnServer, queuescanner.ColumnTargetPort}
+
 func init() {
 	rootCmd.AddCommand(directCmd)
 
@@ -43,6 +50,7 @@ func init() {
 	directCmd.Flags().IntVar(&directFlagTimeoutConnect, "timeout-connect", 5, "TCP connect timeout in seconds")
 	directCmd.Flags().IntVar(&directFlagTimeoutRequest, "timeout-request", 10, "Overall request timeout in seconds")
 	directCmd.Flags().IntVar(&directFlagTimeoutDNS, "timeout-dns", 5, "DNS lookup timeout in seconds")
+	directFlagTLS.register(directCmd)
 }
 
 func parsePorts(portSpec string) ([]string, error) {
@@ -96,21 +104,34 @@ func extractHTTPHeaders(response string) (statusCode int, server string, locatio
 	return statusCode, server, location
 }
 
-func scanDirect(ctx *queuescanner.Ctx, host string) {
+func scanDirect(ctx *queuescanner.Ctx, host string) error {
 	ports, err := parsePorts(directFlagPort)
 	if err != nil {
-		return
+		return err
 	}
 
-	lookupCtx, cancel := context.WithTimeout(context.Background(), time.Duration(directFlagTimeoutDNS)*time.Second)
+	lookupCtx, cancel := context.WithTimeout(ctx.Context(), time.Duration(directFlagTimeoutDNS)*time.Second)
 	defer cancel()
 
+	lookupStart := time.Now()
 	ipStr, err := ResolveIP(lookupCtx, host)
 	if err != nil {
-		return
+		return err
+	}
+	var lookup time.Duration
+	if ipStr != host {
+		lookup = time.Since(lookupStart) // IP addresses are not looked up
 	}
 
+	// Report the last failure only if no port was a hit
+	var lastErr error
+	hit := false
+
 	for _, port := range ports {
+		// Latency is per port and leaves out the shared lookup
+		watch := queuescanner.NewStopwatch()
+		timing := queuescanner.Timing{DNS: lookup}
+		ctx.SetTiming(&timing)
 		useTLS := false
 		commonHTTPSPorts := []string{"443", "8443", "9443", "10443"}
 		for _, httpsPort := range commonHTTPSPorts {
@@ -120,25 +141,38 @@ func scanDirect(ctx *queuescanner.Ctx, host string) {
 			}
 		}
 
-		address := fmt.Sprintf("%s:%s", ipStr, port)
+		address := net.JoinHostPort(ipStr, port)
 		network := "tcp4"
 
 		dialer := &net.Dialer{
 			Timeout: time.Duration(directFlagTimeoutConnect) * time.Second,
 		}
 
-		var conn net.Conn
-		if useTLS {
-			conn, err = tls.DialWithDialer(dialer, network, address, &tls.Config{
-				InsecureSkipVerify: true,
-				ServerName:         host,
-			})
-		} else {
-			conn, err = dialer.Dial(network, address)
-		}
+		conn, err := dialer.DialContext(ctx.Context(), network, address)
 		if err != nil {
+			lastErr = err
 			continue
 		}
+		timing.Connect = watch.Lap()
+
+		if useTLS {
+			tlsConn := tls.Client(conn, clientConfig(directTLSConfig, host))
+			handshakeCtx, cancel := context.WithTimeout(ctx.Context(), time.Duration(directFlagTimeoutConnect)*time.Second)
+			err = tlsConn.HandshakeContext(handshakeCtx)
+			cancel()
+			if err != nil {
+				tlsConn.Close()
+				lastErr = queuescanner.Fail(queuescanner.FailureTLSHandshake, err)
+				continue
+			}
+			if err := checkHTTP1(tlsConn.ConnectionState()); err != nil {
+				tlsConn.Close()
+				lastErr = err
+				continue
+			}
+			conn = tlsConn
+			timing.TLS = watch.Lap()
+		}
 
 		conn.SetDeadline(time.Now().Add(time.Duration(directFlagTimeoutRequest) * time.Second))
 
@@ -152,15 +186,18 @@ func scanDirect(ctx *queuescanner.Ctx, host string) {
 		_, err = conn.Write([]byte(httpRequest))
 		if err != nil {
 			conn.Close()
+			lastErr = err
 			continue
 		}
 
 		buffer := bufferPool.Get().([]byte)
 		n, err := conn.Read(buffer)
+		timing.FirstByte = watch.Lap()
 		conn.Close()
 
 		if err != nil {
 			bufferPool.Put(buffer) // Return on error too
+			lastErr = err
 			continue
 		}
 
@@ -169,27 +206,47 @@ func scanDirect(ctx *queuescanner.Ctx, host string) {
 		statusCode, server, location := extractHTTPHeaders(response)
 
 		if directFlagHideLocation != "" && location == directFlagHideLocation {
+			lastErr = queuescanner.Fail(queuescanner.FailureFiltered, fmt.Errorf("location %s", location))
 			continue
 		}
 
-		hostWithPort := fmt.Sprintf("%s:%s", host, port)
-		formatted := fmt.Sprintf("%-15s  %-3d   %-16s    %s", ipStr, statusCode, server, hostWithPort)
+		portNum, _ := strconv.Atoi(port)
+		res := &queuescanner.Result{
+			Target:   host,
+			IP:       ipStr,
+			Port:     portNum,
+			Status:   statusCode,
+			Server:   server,
+			Location: location,
+			Latency:  watch.Elapsed(),
+			Timing:   &timing,
+		}
+		if tlsConn, ok := conn.(*tls.Conn); ok {
+			res.TLS = queuescanner.NewTLSInfo(tlsConn.ConnectionState())
+		}
+
+		ctx.ScanSuccess(res)
+		hit = true
+	}
 
-		ctx.ScanSuccess(formatted)
-		ctx.Log(formatted)
+	if hit {
+		return nil
 	}
+	return lastErr
 }
 
 func scanDirectRun(cmd *cobra.Command, args []string) {
-	hosts, err := ReadFile(directFlagFilename)
+	hosts, err := openTargetFile(directFlagFilename)
+	if err != nil {
+		fatal(err)
+	}
+	directTLSConfig, err = directFlagTLS.httpConfig()
 	if err != nil {
 		fatal(err)
 	}
 
-	fmt.Printf("%s%-15s  %-4s  %-16s    %s%s\n", ColorCyan+ColorBold, "IP ADDRESS", "CODE", "SERVER", "HOST", ColorReset)
-	fmt.Printf("%s%-15s  %-4s  %-16s    %s%s\n", ColorCyan, "----------", "----", "------", "----", ColorReset)
-
-	qs := queuescanner.New(globalFlagThreads, scanDirect)
+	qs := newQueueScanner(cmd, scanDirect)
+	qs.SetColumns(directColumns...)
 	qs.SetOptions(hosts, directFlagOutput, globalFlagStatInterval)
-	qs.Start()
+	runQueueScanner(qs)
 }
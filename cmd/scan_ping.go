@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"strconv"
@@ -24,6 +25,8 @@ var (
 	pingFlagPort     int
 )
 
+var pingColumns = []queuescanner.Column{queuescanner.ColumnIP, queuescanner.ColumnTarget}
+
 func init() {
 	rootCmd.AddCommand(pingCmd)
 
@@ -33,12 +36,48 @@ func init() {
 	pingCmd.Flags().IntVar(&pingFlagPort, "port", 443, "port to use")
 }
 
-func pingHost(ctx *queuescanner.Ctx, host string) {
-	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(pingFlagPort)), time.Duration(pingFlagTimeout)*time.Second)
+func pingHost(ctx *queuescanner.Ctx, host string) error {
+	watch := queuescanner.NewStopwatch()
+	var timing queuescanner.Timing
+	ctx.SetTiming(&timing)
+
+	// Resolve separately so the lookup is not counted as connect time.
+	// Both address families are looked up and nothing is cached, like a
+	// plain dial would.
+	addrs := []string{host}
+	if net.ParseIP(host) == nil {
+		lookupCtx, cancel := context.WithTimeout(ctx.Context(), time.Duration(pingFlagTimeout)*time.Second)
+		defer cancel()
+
+		ips, err := net.DefaultResolver.LookupIPAddr(lookupCtx, host)
+		if err != nil {
+			return queuescanner.Fail(queuescanner.FailureDNS, err)
+		}
+		if len(ips) == 0 {
+			return queuescanner.Fail(queuescanner.FailureDNS, fmt.Errorf("no IP found for host: %s", host))
+		}
+		addrs = addrs[:0]
+		for _, ip := range ips {
+			addrs = append(addrs, ip.String())
+		}
+		timing.DNS = watch.Lap()
+	}
+
+	// Try the addresses in turn, as a dial of the name would
+	dialer := &net.Dialer{Timeout: time.Duration(pingFlagTimeout) * time.Second}
+	var conn net.Conn
+	var err error
+	for _, addr := range addrs {
+		conn, err = dialer.DialContext(ctx.Context(), "tcp", net.JoinHostPort(addr, strconv.Itoa(pingFlagPort)))
+		if err == nil {
+			break
+		}
+	}
 	if err != nil {
-		return
+		return err
 	}
 	defer conn.Close()
+	timing.Connect = watch.Lap()
 
 	remoteAddr := conn.RemoteAddr()
 	ip, _, err := net.SplitHostPort(remoteAddr.String())
@@ -46,21 +85,25 @@ func pingHost(ctx *queuescanner.Ctx, host string) {
 		ip = remoteAddr.String()
 	}
 
-	formatted := fmt.Sprintf("%-16s %-20s", ip, host)
-	ctx.ScanSuccess(formatted)
-	ctx.Log(formatted)
+	ctx.ScanSuccess(&queuescanner.Result{
+		Target:  host,
+		IP:      ip,
+		Port:    pingFlagPort,
+		Latency: watch.Elapsed(),
+		Timing:  &timing,
+	})
+
+	return nil
 }
 
 func pingRun(cmd *cobra.Command, args []string) {
-	hosts, err := ReadFile(pingFlagFilename)
+	hosts, err := openTargetFile(pingFlagFilename)
 	if err != nil {
 		fatal(err)
 	}
 
-	fmt.Printf("%s%-16s %-20s%s\n", ColorCyan+ColorBold, "IP ADDRESS", "HOST", ColorReset)
-	fmt.Printf("%s%-16s %-20s%s\n", ColorCyan, "----------", "----", ColorReset)
-
-	qs := queuescanner.New(globalFlagThreads, pingHost)
+	qs := newQueueScanner(cmd, pingHost)
+	qs.SetColumns(pingColumns...)
 	qs.SetOptions(hosts, pingFlagOutput, globalFlagStatInterval)
-	qs.Start()
+	runQueueScanner(qs)
 }
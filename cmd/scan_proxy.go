@@ -3,8 +3,10 @@ package cmd
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -36,6 +38,8 @@ var (
 	proxyFlagOutput            string
 )
 
+var proxyColumns = []queuescanner.Column{queuescanner.ColumnAddress.Named("PROXY ADDRESS"), queuescanner.ColumnResponse}
+
 func init() {
 	rootCmd.AddCommand(proxyCmd)
 
@@ -53,7 +57,10 @@ func init() {
 	proxyCmd.Flags().StringVarP(&proxyFlagOutput, "output", "o", "", "output result")
 }
 
-func scanProxy(ctx *queuescanner.Ctx, host string) {
+func scanProxy(ctx *queuescanner.Ctx, host string) error {
+	watch := queuescanner.NewStopwatch()
+	var timing queuescanner.Timing
+	ctx.SetTiming(&timing)
 
 	bug := proxyFlagBug
 	if bug == "" {
@@ -69,35 +76,42 @@ func scanProxy(ctx *queuescanner.Ctx, host string) {
 	}
 
 	// Resolve IP for proxy
-	lookupCtx, lookupCancel := context.WithTimeout(context.Background(), 3*time.Second)
+	lookupCtx, lookupCancel := context.WithTimeout(ctx.Context(), 3*time.Second)
 	defer lookupCancel()
 
 	ipStr, err := ResolveIP(lookupCtx, host)
 	if err != nil {
-		return
+		return err
+	}
+	if lookup := watch.Lap(); ipStr != host {
+		timing.DNS = lookup // IP addresses are not looked up
 	}
 
 	address := net.JoinHostPort(ipStr, strconv.Itoa(proxyFlagProxyPort))
 
-	conn, err := net.DialTimeout("tcp", address, 3*time.Second)
+	dialer := &net.Dialer{Timeout: 3 * time.Second}
+	conn, err := dialer.DialContext(ctx.Context(), "tcp", address)
 	if err != nil {
-		return
+		return err
 	}
 	defer conn.Close()
+	timing.Connect = watch.Lap()
 
-	timeoutCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	timeoutCtx, cancel := context.WithTimeout(ctx.Context(), 10*time.Second)
 	defer cancel()
 
-	resultCh := make(chan bool)
+	// The goroutine only reads the response; the result is reported here so
+	// a timed out probe can't also count as a hit
+	resultCh := make(chan probeResult, 1)
 
 	go func() {
 		payload := getScanProxyPayloadDecoded(bug)
 		payload = strings.ReplaceAll(payload, "[host]", proxyFlagTarget)
 		payload = strings.ReplaceAll(payload, "[crlf]", "\r\n")
 
-		_, err = conn.Write([]byte(payload))
+		_, err := conn.Write([]byte(payload))
 		if err != nil {
-			resultCh <- false
+			resultCh <- probeResult{err: err}
 			return
 		}
 
@@ -105,7 +119,8 @@ func scanProxy(ctx *queuescanner.Ctx, host string) {
 		buf := bufferPool.Get().([]byte)
 		defer bufferPool.Put(buf)
 
-		scanner := bufio.NewScanner(conn)
+		response := &firstByteReader{Reader: conn, watch: watch}
+		scanner := bufio.NewScanner(response)
 		scanner.Buffer(buf, 4096)
 		
 		isPrefix := true
@@ -123,26 +138,50 @@ func scanProxy(ctx *queuescanner.Ctx, host string) {
 		}
 
 		if len(responseLines) == 0 {
-			resultCh <- false
+			if err := scanner.Err(); err != nil {
+				resultCh <- probeResult{err: err}
+			} else {
+				resultCh <- probeResult{err: errEmptyResponse}
+			}
 			return
 		}
 
-		if strings.Contains(responseLines[0], " 302 ") {
-			resultCh <- true
-			return
+		timing.FirstByte = response.wait
+
+		statusCode, server, location := extractHTTPHeaders(strings.Join(responseLines, "\n"))
+		res := &queuescanner.Result{
+			Target:   host,
+			IP:       ipStr,
+			Port:     proxyFlagProxyPort,
+			Status:   statusCode,
+			Server:   server,
+			Location: location,
+			Latency:  watch.Elapsed(),
+			Timing:   &timing,
 		}
-
-		resultString := fmt.Sprintf("%-32s %s", address, strings.Join(responseLines, " -- "))
-		ctx.ScanSuccess(resultString)
-		ctx.Log(resultString)
-
-		resultCh <- true
+		res.SetField("status_line", responseLines[0])
+		resultCh <- probeResult{res: res}
 	}()
 
+	var probe probeResult
 	select {
-	case <-resultCh:
+	case probe = <-resultCh:
 	case <-timeoutCtx.Done():
+		// Unblock the goroutine and wait for it, so it is done with the connection
+		conn.Close()
+		<-resultCh
+		return queuescanner.Fail(queuescanner.FailureReadTimeout, timeoutCtx.Err())
+	}
+	if probe.err != nil {
+		return probe.err
 	}
+
+	if probe.res.Status == 302 {
+		return queuescanner.Fail(queuescanner.FailureUnexpectedStatus, errors.New(probe.res.Fields["status_line"]))
+	}
+	ctx.ScanSuccess(probe.res)
+
+	return nil
 }
 
 func getScanProxyPayloadDecoded(bug ...string) string {
@@ -157,33 +196,33 @@ func getScanProxyPayloadDecoded(bug ...string) string {
 }
 
 func runScanProxy(cmd *cobra.Command, args []string) {
-	var proxyHosts []string
+	var sources []queuescanner.TargetSource
 
 	if proxyFlagProxyHost != "" {
-		proxyHosts = append(proxyHosts, proxyFlagProxyHost)
+		sources = append(sources, queuescanner.NewSliceSource([]string{proxyFlagProxyHost}))
 	}
 
 	if proxyFlagProxyHostFilename != "" {
-		lines, err := ReadFile(proxyFlagProxyHostFilename)
+		lines, err := openTargetFile(proxyFlagProxyHostFilename)
 		if err != nil {
 			fatal(err)
 		}
-		proxyHosts = append(proxyHosts, lines...)
+		sources = append(sources, lines)
 	}
 
 	if proxyFlagProxyCIDR != "" {
-		cidrHosts, err := IPsFromCIDR(proxyFlagProxyCIDR)
+		cidrHosts, err := queuescanner.NewCIDRSource(proxyFlagProxyCIDR)
 		if err != nil {
 			fatal(err)
 		}
-		proxyHosts = append(proxyHosts, cidrHosts...)
+		sources = append(sources, cidrHosts)
 	}
 
-	fmt.Printf("%s%-32s %s%s\n", ColorCyan+ColorBold, "PROXY ADDRESS", "RESPONSE", ColorReset)
-	fmt.Printf("%s%-32s %s%s\n", ColorCyan, "-------------", "--------", ColorReset)
+	proxyHosts := queuescanner.NewCompositeSource(sources...)
 
-	qs := queuescanner.New(globalFlagThreads, scanProxy)
-	fmt.Printf("%s\n\n", getScanProxyPayloadDecoded())
+	qs := newQueueScanner(cmd, scanProxy)
+	qs.SetColumns(proxyColumns...)
+	fmt.Fprintf(os.Stderr, "%s\n\n", getScanProxyPayloadDecoded())
 	qs.SetOptions(proxyHosts, proxyFlagOutput, globalFlagStatInterval)
-	qs.Start()
+	runQueueScanner(qs)
 }
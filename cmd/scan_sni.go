@@ -1,10 +1,13 @@
 package cmd
 
 import (
+	"bufio"
 	"context"
 	"crypto/tls"
 	"fmt"
 	"net"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,7 +20,15 @@ import (
 var sniCmd = &cobra.Command{
 	Use:   "sni",
 	Short: "Scan server name indication (SNI) list from file.",
-	Run:   runScanSNI,
+	Long: `Complete a TLS handshake with every host of the list, sending the host as
+the server name (SNI).
+
+By default each host is resolved and its own address is dialled. With
+--connect-ip or --connect-file every host is instead tried as the SNI against
+each of the given addresses, e.g. the edges of a CDN, and a hit is reported
+for every address that accepts it. Every pair is a target of its own, shown
+as host@ip among the failures.`,
+	Run: runScanSNI,
 }
 
 var (
@@ -25,8 +36,48 @@ var (
 	sniFlagDeep     int
 	sniFlagTimeout  int
 	sniFlagOutput   string
+	sniFlagColumns  string
+	sniFlagVerify   bool
+	sniFlagCAFile   string
+	sniFlagValid    bool
+
+	sniFlagPort        int
+	sniFlagConnectIP   string
+	sniFlagConnectFile string
+
+	sniFlagTLS      tlsFlags
+	sniFlagFragment fragmentFlags
 )
 
+// sniTLSConfig is the ClientHello set by the --tls flags
+var sniTLSConfig *tls.Config
+
+// sniFragment is set by --fragment
+var sniFragment *fragmentOptions
+
+// sniConnectSpecs are the IPs and CIDRs of --connect-ip and --connect-file
+var sniConnectSpecs []string
+
+// sniVerifier is set by --verify
+var sniVerifier *certVerifier
+
+var sniColumns = []queuescanner.Column{queuescanner.ColumnIP, queuescanner.ColumnTarget.Named("SNI HOST")}
+
+// sniExtraColumns can be added to the output with --columns
+var sniExtraColumns = map[string]queuescanner.Column{
+	"tls":        queuescanner.ColumnTLSVersion,
+	"cipher":     queuescanner.ColumnCipherSuite,
+	"alpn":       queuescanner.ColumnALPN,
+	"cn":         queuescanner.ColumnCertSubject,
+	"san":        queuescanner.ColumnCertSANs,
+	"issuer":     queuescanner.ColumnCertIssuer,
+	"not-before": queuescanner.ColumnCertNotBefore,
+	"not-after":  queuescanner.ColumnCertNotAfter,
+	"key":        queuescanner.ColumnCertKeyType,
+	"serial":     queuescanner.ColumnCertSerial,
+	"verify":     queuescanner.ColumnCertStatus,
+}
+
 func init() {
 	rootCmd.AddCommand(sniCmd)
 
@@ -34,23 +85,176 @@ func init() {
 	sniCmd.Flags().IntVarP(&sniFlagDeep, "deep", "d", 0, "deep subdomain")
 	sniCmd.Flags().IntVar(&sniFlagTimeout, "timeout", 3, "handshake timeout")
 	sniCmd.Flags().StringVarP(&sniFlagOutput, "output", "o", "", "output result")
+	sniCmd.Flags().StringVar(&sniFlagColumns, "columns", "", "extra columns to show, comma separated: tls, cipher, alpn, cn, san, issuer, not-before, not-after, key, serial, verify")
+	sniCmd.Flags().BoolVar(&sniFlagVerify, "verify", false, "verify the certificate chain and hostname after the handshake and report the outcome")
+	sniCmd.Flags().StringVar(&sniFlagCAFile, "ca-file", "", "verify against the CA certificates in this PEM file instead of the system roots (implies --verify)")
+	sniCmd.Flags().BoolVar(&sniFlagValid, "require-valid", false, "only count handshakes with a valid certificate as success (implies --verify)")
+	sniCmd.Flags().IntVarP(&sniFlagPort, "port", "p", 443, "port to connect to")
+	sniCmd.Flags().StringVar(&sniFlagConnectIP, "connect-ip", "", "try every SNI against these addresses instead of the host's own, comma separated IPs or CIDRs")
+	sniCmd.Flags().StringVar(&sniFlagConnectFile, "connect-file", "", "like --connect-ip, with one IP or CIDR per line of this file")
+	sniFlagTLS.register(sniCmd)
+	sniFlagFragment.register(sniCmd)
+}
+
+// parseConnectSpecs checks that every spec is an IP or a CIDR, skipping
+// blank and comment lines. CIDRs are expanded only when scanned.
+func parseConnectSpecs(specs []string) ([]string, error) {
+	var valid []string
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" || strings.HasPrefix(spec, "#") {
+			continue
+		}
+
+		if ip := net.ParseIP(spec); ip != nil {
+			valid = append(valid, ip.String())
+			continue
+		}
+		if _, _, err := net.ParseCIDR(spec); err != nil {
+			return nil, fmt.Errorf("connect address %q is neither an IP nor a CIDR", spec)
+		}
+		valid = append(valid, spec)
+	}
+	return valid, nil
+}
+
+// loadConnectSpecs returns the IPs and CIDRs of --connect-ip and
+// --connect-file
+func loadConnectSpecs() ([]string, error) {
+	var specs []string
+	if sniFlagConnectIP != "" {
+		specs = append(specs, strings.Split(sniFlagConnectIP, ",")...)
+	}
+	if sniFlagConnectFile != "" {
+		file, err := os.Open(sniFlagConnectFile)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			specs = append(specs, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return parseConnectSpecs(specs)
+}
+
+// sniConnectSource generates the addresses of --connect-ip and
+// --connect-file
+func sniConnectSource() queuescanner.TargetSource {
+	var sources []queuescanner.TargetSource
+	for _, spec := range sniConnectSpecs {
+		if !strings.Contains(spec, "/") {
+			sources = append(sources, queuescanner.NewSliceSource([]string{spec}))
+			continue
+		}
+		src, err := queuescanner.NewCIDRSource(spec)
+		if err != nil {
+			continue // checked by parseConnectSpecs
+		}
+		sources = append(sources, src)
+	}
+	return queuescanner.NewCompositeSource(sources...)
+}
+
+// sniConnectMode reports whether --connect-ip or --connect-file is set
+func sniConnectMode() bool {
+	return sniFlagConnectIP != "" || sniFlagConnectFile != ""
+}
+
+// applySNIConnect pairs every host with the addresses of --connect-ip and
+// --connect-file, if set
+func applySNIConnect(qs *queuescanner.QueueScanner) error {
+	if !sniConnectMode() {
+		return nil
+	}
+
+	specs, err := loadConnectSpecs()
+	if err != nil {
+		return err
+	}
+	sniConnectSpecs = specs
+	if sniConnectSource().Total() == 0 {
+		return fmt.Errorf("no addresses in --connect-ip or --connect-file")
+	}
+	qs.SetProduct(sniConnectSource, sniConnectTarget)
+	return nil
+}
+
+// sniConnectTarget queues host to be tried against the address ip
+func sniConnectTarget(host, ip string) string {
+	return host + "@" + ip
+}
+
+// sniResultColumns returns the columns of the sni command with those added
+// by --columns
+func sniResultColumns() ([]queuescanner.Column, error) {
+	columns := append([]queuescanner.Column(nil), sniColumns...)
+	if sniFlagVerify || sniFlagCAFile != "" || sniFlagValid {
+		columns = append(columns, queuescanner.ColumnCertStatus)
+	}
+	if sniFlagFragment.mode != "off" {
+		columns = append(columns, fragmentColumn)
+	}
+	if sniFlagColumns == "" {
+		return columns, nil
+	}
+
+	for _, name := range strings.Split(sniFlagColumns, ",") {
+		name = strings.TrimSpace(name)
+		col, ok := sniExtraColumns[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q (want %s)", name, strings.Join(sortedKeys(sniExtraColumns), ", "))
+		}
+		columns = append(columns, col)
+	}
+	return columns, nil
 }
 
-func scanSNI(ctx *queuescanner.Ctx, host string) {
+func scanSNI(ctx *queuescanner.Ctx, host string) error {
+	watch := queuescanner.NewStopwatch()
+	var timing queuescanner.Timing
+	ctx.SetTiming(&timing)
+
+	if sniConnectMode() {
+		// The target is a pair of the SNI and the address to try it against
+		sni, ip, ok := strings.Cut(host, "@")
+		if !ok || net.ParseIP(ip) == nil {
+			return fmt.Errorf("target %q is not a host@ip pair of --connect-ip", host)
+		}
+		return sniHandshake(ctx, sni, ip, watch, &timing)
+	}
+
 	// Resolve IP first (uses cache)
-	lookupCtx, cancel := context.WithTimeout(context.Background(), time.Duration(sniFlagTimeout)*time.Second)
+	lookupCtx, cancel := context.WithTimeout(ctx.Context(), time.Duration(sniFlagTimeout)*time.Second)
 	defer cancel()
 	
 	ipStr, err := ResolveIP(lookupCtx, host)
 	if err != nil {
-		return
+		return err
+	}
+	if lookup := watch.Lap(); ipStr != host {
+		timing.DNS = lookup // IP addresses are not looked up
 	}
 
-	conn, err := net.DialTimeout("tcp", ipStr+":443", 3*time.Second)
+	return sniHandshake(ctx, host, ipStr, watch, &timing)
+}
+
+// sniHandshake connects to ipStr and completes a handshake sending host as
+// the SNI. watch and timing continue those of the lookup, if any.
+func sniHandshake(ctx *queuescanner.Ctx, host, ipStr string, watch *queuescanner.Stopwatch, timing *queuescanner.Timing) error {
+	address := net.JoinHostPort(ipStr, strconv.Itoa(sniFlagPort))
+	dialer := &net.Dialer{Timeout: 3 * time.Second}
+	conn, err := dialer.DialContext(ctx.Context(), "tcp", address)
 	if err != nil {
-		return
+		return err
 	}
 	defer conn.Close()
+	timing.Connect = watch.Lap()
 
 	remoteAddr := conn.RemoteAddr()
 	ip, _, err := net.SplitHostPort(remoteAddr.String())
@@ -58,47 +262,105 @@ func scanSNI(ctx *queuescanner.Ctx, host string) {
 		ip = remoteAddr.String()
 	}
 
-	tlsConn := tls.Client(conn, &tls.Config{
-		ServerName:         host,
-		InsecureSkipVerify: true,
-	})
-	defer tlsConn.Close()
-
-	handshakeCtx, cancel := context.WithTimeout(context.Background(), time.Duration(sniFlagTimeout)*time.Second)
+	timeout := time.Duration(sniFlagTimeout) * time.Second
+	handshakeCtx, cancel := context.WithTimeout(ctx.Context(), timeout)
 	defer cancel()
 
+	cfg := clientConfig(sniTLSConfig, host)
+	tlsConn := tls.Client(sniFragment.wrap(handshakeCtx, conn), cfg)
+	defer tlsConn.Close()
+
 	err = tlsConn.HandshakeContext(handshakeCtx)
 	if err != nil {
-		return
+		return sniFragment.comparePlain(ctx.Context(), address, cfg, timeout).failure(err)
 	}
+	timing.TLS = watch.Lap()
 
-	formatted := fmt.Sprintf("%-16s %-20s", ip, host)
-	ctx.ScanSuccess(formatted)
-	ctx.Log(formatted)
+	state := tlsConn.ConnectionState()
+	info := queuescanner.NewTLSInfo(state)
+	if len(state.PeerCertificates) > 0 {
+		// Whether the edge serves a certificate for the SNI sent
+		info.Certificate = queuescanner.NewCertInfo(state.PeerCertificates[0])
+	}
+
+	res := &queuescanner.Result{
+		Target:  host,
+		IP:      ip,
+		Port:    sniFlagPort,
+		Latency: watch.Elapsed(),
+		Timing:  timing,
+		TLS:     info,
+	}
+	if err := sniVerifier.check(state, host, info); err != nil {
+		return err
+	}
+	if sniFragment != nil {
+		// Done with this connection; servers may limit connections per client
+		tlsConn.Close()
+		sniFragment.comparePlain(ctx.Context(), address, cfg, timeout).report(res)
+	}
+
+	ctx.ScanSuccess(res)
+
+	return nil
+}
+
+// sniDeepDomain keeps the last --deep labels of domain
+func sniDeepDomain(domain string) string {
+	domainSplit := strings.Split(domain, ".")
+	if len(domainSplit) >= sniFlagDeep {
+		domain = strings.Join(domainSplit[len(domainSplit)-sniFlagDeep:], ".")
+	}
+	return domain
+}
+
+// applySNIDeep cuts the domains down to --deep labels, if set
+func applySNIDeep(qs *queuescanner.QueueScanner, domains queuescanner.TargetSource) queuescanner.TargetSource {
+	if sniFlagDeep <= 0 {
+		return domains
+	}
+
+	// Cut down hosts after normalisation so the parent domains are deduplicated
+	if globalFlagNormalize {
+		opts := normalizeOptions()
+		opts.Rewrite = sniDeepDomain
+		qs.SetNormalize(opts)
+		return domains
+	}
+	return queuescanner.NewMapSource(domains, sniDeepDomain)
 }
 
 func runScanSNI(cmd *cobra.Command, args []string) {
-	lines, err := ReadFile(sniFlagFilename)
+	domains, err := openTargetFile(sniFlagFilename)
 	if err != nil {
 		fatal(err)
 	}
 
-	var domains []string
-
-	for _, domain := range lines {
-		if sniFlagDeep > 0 {
-			domainSplit := strings.Split(domain, ".")
-			if len(domainSplit) >= sniFlagDeep {
-				domain = strings.Join(domainSplit[len(domainSplit)-sniFlagDeep:], ".")
-			}
+	columns, err := sniResultColumns()
+	if err != nil {
+		fatal(err)
+	}
+	sniVerifier, err = newCertVerifier(sniFlagVerify, sniFlagCAFile, sniFlagValid)
+	if err != nil {
+		fatal(err)
+	}
+	sniTLSConfig, err = sniFlagTLS.config()
+	if err != nil {
+		fatal(err)
+	}
+	sniFragment, err = sniFlagFragment.options()
+	if err != nil {
+		fatal(err)
+	}
+	qs := newQueueScanner(cmd, scanSNI)
+	domains = applySNIDeep(qs, domains)
+	// A worker is handed the pairs by the coordinator
+	if coordinatorClient == nil {
+		if err := applySNIConnect(qs); err != nil {
+			fatal(err)
 		}
-		domains = append(domains, domain)
 	}
-
-	fmt.Printf("%s%-16s %-20s%s\n", ColorCyan+ColorBold, "IP ADDRESS", "SNI HOST", ColorReset)
-	fmt.Printf("%s%-16s %-20s%s\n", ColorCyan, "----------", "--------", ColorReset)
-
-	qs := queuescanner.New(globalFlagThreads, scanSNI)
+	qs.SetColumns(columns...)
 	qs.SetOptions(domains, sniFlagOutput, globalFlagStatInterval)
-	qs.Start()
+	runQueueScanner(qs)
 }
@@ -0,0 +1,307 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/SirYadav1/flashscan-go/pkg/queuescanner"
+)
+
+// certVerifier checks the certificate of handshakes made with
+// InsecureSkipVerify, for --verify
+type certVerifier struct {
+	roots        *x509.CertPool // nil for the system roots
+	requireValid bool           // fail targets whose certificate is not valid
+}
+
+// newCertVerifier returns the verifier for the --verify, --ca-file and
+// --require-valid flags of a command, or nil when certificates are not
+// verified
+func newCertVerifier(verify bool, caFile string, requireValid bool) (*certVerifier, error) {
+	if !verify && !requireValid && caFile == "" {
+		return nil, nil
+	}
+
+	v := &certVerifier{requireValid: requireValid}
+	if caFile != "" {
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		v.roots = x509.NewCertPool()
+		if !v.roots.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no PEM certificates in %s", caFile)
+		}
+	}
+	return v, nil
+}
+
+// check records the verification status of the handshake in info. With
+// --require-valid, it fails unless the certificate is valid for serverName;
+// the failure carries info.
+func (v *certVerifier) check(state tls.ConnectionState, serverName string, info *queuescanner.TLSInfo) error {
+	if v == nil {
+		return nil
+	}
+
+	info.Verification = queuescanner.VerifyCertificate(state, serverName, v.roots)
+	if v.requireValid && info.Verification != queuescanner.CertValid {
+		return &queuescanner.Failure{
+			Class: queuescanner.FailureCertificate,
+			Err:   fmt.Errorf("certificate %s", info.Verification),
+			TLS:   info,
+		}
+	}
+	return nil
+}
+
+// helloProfile is a built-in set of ClientHello parameters. crypto/tls does
+// not let the extension order or GREASE be set, so a profile matches the
+// offered versions, cipher suites, groups and ALPN of a client rather than
+// its exact fingerprint.
+type helloProfile struct {
+	minVersion uint16
+	maxVersion uint16
+	ciphers    []uint16 // TLS 1.2 and below; TLS 1.3 suites are fixed
+	curves     []tls.CurveID
+	alpn       []string
+}
+
+// modernCiphers are the ECDHE AEAD suites current browsers offer first
+var modernCiphers = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// legacyCiphers are the CBC and RSA key exchange suites kept for old servers
+var legacyCiphers = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+	tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+	tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+}
+
+// helloProfiles are the values of --tls-hello; "go" leaves the defaults
+var helloProfiles = map[string]helloProfile{
+	"go": {},
+	"chrome": {
+		minVersion: tls.VersionTLS12,
+		maxVersion: tls.VersionTLS13,
+		ciphers:    append(append([]uint16(nil), modernCiphers...), legacyCiphers...),
+		curves:     []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384},
+		alpn:       []string{"h2", "http/1.1"},
+	},
+	"firefox": {
+		minVersion: tls.VersionTLS12,
+		maxVersion: tls.VersionTLS13,
+		ciphers: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+			tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+			tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+		},
+		curves: []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384, tls.CurveP521},
+		alpn:   []string{"h2", "http/1.1"},
+	},
+	"okhttp": {
+		minVersion: tls.VersionTLS12,
+		maxVersion: tls.VersionTLS13,
+		ciphers:    append(append([]uint16(nil), modernCiphers...), legacyCiphers[:4]...),
+		curves:     []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384},
+		alpn:       []string{"h2", "http/1.1"},
+	},
+	"legacy": {
+		minVersion: tls.VersionTLS10,
+		maxVersion: tls.VersionTLS12,
+		ciphers:    append(append([]uint16(nil), modernCiphers...), legacyCiphers...),
+		curves:     []tls.CurveID{tls.CurveP256, tls.CurveP384, tls.CurveP521},
+		alpn:       []string{"http/1.1"},
+	},
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var tlsCurves = map[string]tls.CurveID{
+	"X25519": tls.X25519,
+	"P256":   tls.CurveP256,
+	"P384":   tls.CurveP384,
+	"P521":   tls.CurveP521,
+}
+
+// tlsFlags configure the ClientHello of a scan command. Each command has its
+// own, so pipeline stages can send different handshakes.
+type tlsFlags struct {
+	hello      string
+	minVersion string
+	maxVersion string
+	ciphers    string
+	curves     string
+	alpn       string
+	tickets    string
+}
+
+func (f *tlsFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.hello, "tls-hello", "go", "built-in ClientHello profile: "+strings.Join(sortedKeys(helloProfiles), ", ")+"; the other --tls flags override it")
+	cmd.Flags().StringVar(&f.minVersion, "tls-min", "", "lowest TLS version to offer: 1.0, 1.1, 1.2 or 1.3")
+	cmd.Flags().StringVar(&f.maxVersion, "tls-max", "", "highest TLS version to offer: 1.0, 1.1, 1.2 or 1.3")
+	cmd.Flags().StringVar(&f.ciphers, "tls-ciphers", "", "comma separated cipher suites for TLS 1.2 and below, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256")
+	cmd.Flags().StringVar(&f.curves, "tls-curves", "", "comma separated key exchange groups in order of preference: X25519, P256, P384, P521")
+	cmd.Flags().StringVar(&f.alpn, "tls-alpn", "", `comma separated ALPN protocols, e.g. "h2,http/1.1"`)
+	cmd.Flags().StringVar(&f.tickets, "tls-tickets", "on", "session tickets: on, off, or resume to reuse sessions across probes of the same host")
+}
+
+// config returns the base TLS config of the command's probes. The scan
+// functions clone it and set the server name.
+func (f *tlsFlags) config() (*tls.Config, error) {
+	profile, ok := helloProfiles[f.hello]
+	if !ok {
+		return nil, fmt.Errorf("unknown --tls-hello %q (want %s)", f.hello, strings.Join(sortedKeys(helloProfiles), ", "))
+	}
+
+	cfg := &tls.Config{
+		InsecureSkipVerify: true,
+		MinVersion:         profile.minVersion,
+		MaxVersion:         profile.maxVersion,
+		CipherSuites:       profile.ciphers,
+		CurvePreferences:   profile.curves,
+		NextProtos:         profile.alpn,
+	}
+
+	if f.minVersion != "" {
+		v, ok := tlsVersions[f.minVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown --tls-min %q (want %s)", f.minVersion, strings.Join(sortedKeys(tlsVersions), ", "))
+		}
+		cfg.MinVersion = v
+	}
+	if f.maxVersion != "" {
+		v, ok := tlsVersions[f.maxVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown --tls-max %q (want %s)", f.maxVersion, strings.Join(sortedKeys(tlsVersions), ", "))
+		}
+		cfg.MaxVersion = v
+	}
+	if cfg.MinVersion != 0 && cfg.MaxVersion != 0 && cfg.MinVersion > cfg.MaxVersion {
+		return nil, fmt.Errorf("--tls-min is above --tls-max")
+	}
+
+	if f.ciphers != "" {
+		suites := make(map[string]uint16)
+		for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+			suites[suite.Name] = suite.ID
+		}
+		cfg.CipherSuites = nil
+		for _, name := range splitList(f.ciphers) {
+			id, ok := suites[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown cipher suite %q", name)
+			}
+			cfg.CipherSuites = append(cfg.CipherSuites, id)
+		}
+	}
+
+	if f.curves != "" {
+		cfg.CurvePreferences = nil
+		for _, name := range splitList(f.curves) {
+			id, ok := tlsCurves[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown curve %q (want %s)", name, strings.Join(sortedKeys(tlsCurves), ", "))
+			}
+			cfg.CurvePreferences = append(cfg.CurvePreferences, id)
+		}
+	}
+
+	if f.alpn != "" {
+		cfg.NextProtos = splitList(f.alpn)
+	}
+
+	switch f.tickets {
+	case "on":
+	case "off":
+		cfg.SessionTicketsDisabled = true
+	case "resume":
+		cfg.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	default:
+		return nil, fmt.Errorf("unknown --tls-tickets %q (want on, off or resume)", f.tickets)
+	}
+
+	return cfg, nil
+}
+
+// httpConfig is config for commands that send an HTTP/1.1 request: the
+// profile's ALPN is cut down to http/1.1, unless --tls-alpn sets it
+func (f *tlsFlags) httpConfig() (*tls.Config, error) {
+	cfg, err := f.config()
+	if err != nil {
+		return nil, err
+	}
+	if f.alpn == "" && len(cfg.NextProtos) > 0 {
+		cfg.NextProtos = []string{"http/1.1"}
+	}
+	return cfg, nil
+}
+
+// checkHTTP1 fails a handshake that negotiated an ALPN protocol other than
+// http/1.1, offered with --tls-alpn, as the request sent next is HTTP/1.1
+func checkHTTP1(state tls.ConnectionState) error {
+	if proto := state.NegotiatedProtocol; proto != "" && proto != "http/1.1" {
+		return queuescanner.Fail(queuescanner.FailureTLSHandshake, fmt.Errorf("server chose ALPN %s, only http/1.1 is spoken", proto))
+	}
+	return nil
+}
+
+// clientConfig returns a copy of base for a handshake sending serverName
+func clientConfig(base *tls.Config, serverName string) *tls.Config {
+	cfg := base.Clone()
+	cfg.ServerName = serverName
+	return cfg
+}
+
+// splitList splits a comma separated flag value, dropping empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
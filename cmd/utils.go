@@ -1,16 +1,35 @@
 package cmd
 
 import (
-	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"net"
 	"os"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/SirYadav1/flashscan-go/pkg/queuescanner"
 )
 
+// errEmptyResponse is returned when a connection closes without any response
+var errEmptyResponse = errors.New("empty response")
+
+// probeResult is what a goroutine reading a response hands back: the
+// response, or the error that ended the read
+type probeResult struct {
+	res *queuescanner.Result
+	err error
+}
+
 var (
 	ipRegex    = regexp.MustCompile(`\d+$`)
 	dnsCache   sync.Map
@@ -35,10 +54,10 @@ func ResolveIP(ctx context.Context, host string) (string, error) {
 	// Lookup
 	ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
 	if err != nil {
-		return "", err
+		return "", queuescanner.Fail(queuescanner.FailureDNS, err)
 	}
 	if len(ips) == 0 {
-		return "", fmt.Errorf("no IP found for host: %s", host)
+		return "", queuescanner.Fail(queuescanner.FailureDNS, fmt.Errorf("no IP found for host: %s", host))
 	}
 
 	ipStr := ips[0].String()
@@ -46,72 +65,174 @@ func ResolveIP(ctx context.Context, host string) (string, error) {
 	return ipStr, nil
 }
 
-func ReadFile(filename string) ([]string, error) {
-	var reader io.Reader
-
+// openTargetFile streams targets from filename, or from stdin when filename
+// is empty or "-".
+func openTargetFile(filename string) (queuescanner.TargetSource, error) {
+	// A worker gets its targets from the coordinator
+	if coordinatorClient != nil {
+		return queuescanner.NewSliceSource(nil), nil
+	}
+	// and a pipeline stage from the stage before
+	if pipelineBuild != nil && pipelineBuild.input != nil {
+		return pipelineBuild.input, nil
+	}
 	if filename == "" || filename == "-" {
-		stat, err := os.Stdin.Stat()
-		if err != nil {
-			return nil, fmt.Errorf("error checking stdin: %w", err)
-		}
+		return queuescanner.NewStdinSource()
+	}
+	return queuescanner.NewFileSource(filename)
+}
 
-		if (stat.Mode() & os.ModeCharDevice) == 0 {
-			reader = os.Stdin
-		} else {
-			return nil, fmt.Errorf("no input provided: use -f flag or pipe data via stdin")
+// firstByteReader times the wait for the first byte of a response, from
+// the last lap of watch
+type firstByteReader struct {
+	io.Reader
+	watch *queuescanner.Stopwatch
+	wait  time.Duration // 0 until the first byte arrives
+}
+
+func (r *firstByteReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 && r.wait == 0 {
+		r.wait = r.watch.Lap()
+	}
+	return n, err
+}
+
+// scanCommands are the commands that can be run by a coordinator's workers
+// or as a pipeline stage, with their result columns once the flags are parsed
+var scanCommands = map[string]struct {
+	cmd     *cobra.Command
+	columns func() ([]queuescanner.Column, error)
+}{
+	"sni":     {sniCmd, sniResultColumns},
+	"direct":  {directCmd, fixedColumns(directColumns)},
+	"cdn-ssl": {cdnSSLCmd, cdnSSLResultColumns},
+	"proxy":   {proxyCmd, fixedColumns(proxyColumns)},
+	"ping":    {pingCmd, fixedColumns(pingColumns)},
+}
+
+// fixedColumns is the columns func of a command that has no column flags
+func fixedColumns(columns []queuescanner.Column) func() ([]queuescanner.Column, error) {
+	return func() ([]queuescanner.Column, error) {
+		return columns, nil
+	}
+}
+
+// parseScanCommand parses args as the flags of the named scan command.
+func parseScanCommand(name string, args []string) (*cobra.Command, []queuescanner.Column, error) {
+	scan, ok := scanCommands[name]
+	if !ok {
+		names := make([]string, 0, len(scanCommands))
+		for name := range scanCommands {
+			names = append(names, name)
 		}
-	} else {
-		file, err := os.Open(filename)
+		sort.Strings(names)
+		return nil, nil, fmt.Errorf("unknown scan command %q (want %s)", name, strings.Join(names, ", "))
+	}
+
+	if err := scan.cmd.ParseFlags(args); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if rest := scan.cmd.Flags().Args(); len(rest) > 0 {
+		return nil, nil, fmt.Errorf("%s: unexpected arguments %q", name, rest)
+	}
+	columns, err := scan.columns()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return scan.cmd, columns, nil
+}
+
+// newQueueScanner creates a queue scanner configured from the global flags.
+func newQueueScanner(cmd *cobra.Command, scanFunc queuescanner.ScanFunc) *queuescanner.QueueScanner {
+	qs := queuescanner.New(globalFlagThreads, scanFunc)
+	qs.SetGracePeriod(time.Duration(globalFlagGracePeriod * float64(time.Second)))
+	qs.SetRateLimit(globalFlagRate, globalFlagBurst)
+	qs.SetRetries(globalFlagRetries, time.Duration(globalFlagRetryBackoff*float64(time.Second)))
+
+	if err := qs.SetOutputFormat(globalFlagOutputFormat); err != nil {
+		fatal(err)
+	}
+	renderer, err := queuescanner.NewRenderer(globalFlagUI)
+	if err != nil {
+		fatal(err)
+	}
+	qs.SetRenderer(renderer)
+	if globalFlagDedup && !globalFlagNormalize {
+		fatal(fmt.Errorf("--dedup needs --normalize"))
+	}
+	if globalFlagNormalize {
+		qs.SetNormalize(normalizeOptions())
+	}
+
+	if globalFlagShard != "" {
+		index, count, err := queuescanner.ParseShard(globalFlagShard)
 		if err != nil {
-			return nil, err
+			fatal(err)
 		}
-		defer file.Close()
-		reader = file
+		qs.SetShard(index, count)
 	}
 
-	var lines []string
-	scanner := bufio.NewScanner(reader)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line != "" {
-			lines = append(lines, line)
-		}
+	if globalFlagOrder != queuescanner.OrderSequential && !cmd.Flags().Changed("seed") {
+		// Set the flag, not just the variable, so --resume replays the same order
+		cmd.Flags().Set("seed", strconv.FormatUint(rand.Uint64(), 10))
+	}
+	if err := qs.SetOrder(globalFlagOrder, globalFlagSeed); err != nil {
+		fatal(err)
+	}
+	if globalFlagFailuresOutput != "" {
+		qs.SetFailuresOutput(globalFlagFailuresOutput)
+	}
+	if globalFlagMetricsListen != "" {
+		qs.SetMetricsListen(globalFlagMetricsListen)
+	}
+	if globalFlagControlListen != "" {
+		qs.SetControlListen(globalFlagControlListen)
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+	if coordinatorClient != nil {
+		qs.SetCoordinator(coordinatorClient)
 	}
 
-	return lines, nil
-}
+	if globalFlagAutoThreads {
+		qs.SetAutoThreads(globalFlagMinThreads, globalFlagMaxThreads)
+	}
 
-func ipInc(ip net.IP) {
-	for j := len(ip) - 1; j >= 0; j-- {
-		ip[j]++
-		if ip[j] > 0 {
-			break
+	if globalFlagResume != "" {
+		cp := resumeCheckpoint
+		if cp == nil {
+			cp = &queuescanner.Checkpoint{Command: cmd.Name()}
 		}
+		cp.Flags = resumeFlags(cmd)
+		qs.SetCheckpoint(globalFlagResume, cp)
 	}
+
+	return qs
 }
 
-func IPsFromCIDR(cidr string) ([]string, error) {
-	ip, ipnet, err := net.ParseCIDR(cidr)
-	if err != nil {
-		return nil, err
+// normalizeOptions returns the input normalisation set by the global flags.
+func normalizeOptions() queuescanner.NormalizeOptions {
+	return queuescanner.NormalizeOptions{
+		Dedup:       globalFlagDedup,
+		DedupMemory: globalFlagDedupMemory << 20,
 	}
+}
 
-	var ips []string
-	for currentIP := ip.Mask(ipnet.Mask); ipnet.Contains(currentIP); ipInc(currentIP) {
-		ips = append(ips, currentIP.String())
-	}
-	if len(ips) <= 1 {
-		return ips, nil
+// runQueueScanner runs the scan and exits if the target source failed.
+func runQueueScanner(qs *queuescanner.QueueScanner) {
+	// A pipeline runs the stages itself
+	if pipelineBuild != nil {
+		pipelineBuild.qs = qs
+		return
 	}
 
-	return ips[1 : len(ips)-1], nil
+	summary := qs.Start()
+	if summary.Err != nil {
+		fatal(summary.Err)
+	}
 }
 
 func fatal(err error) {
-	fmt.Println(err.Error())
+	fmt.Fprintln(os.Stderr, err.Error())
 	os.Exit(1)
 }
@@ -3,6 +3,11 @@ module github.com/SirYadav1/flashscan-go/v2
 go 1.23.2
 
 require (
-    github.com/spf13/cobra v1.9.1
-    golang.org/x/term v0.34.0
+	github.com/spf13/cobra v1.9.1
+	github.com/spf13/pflag v1.0.6
+	golang.org/x/net v0.43.0
+	golang.org/x/sys v0.35.0
+	golang.org/x/term v0.34.0
 )
+
+require golang.org/x/text v0.28.0 // indirect
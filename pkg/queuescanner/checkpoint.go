@@ -0,0 +1,132 @@
+package queuescanner
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CheckpointInterval is how often a resumable scan persists its progress.
+const CheckpointInterval = 5 * time.Second
+
+// Checkpoint is the on-disk state of a resumable scan. Targets are identified
+// by their position in the target source, so a resumed scan must read the
+// same input in the same order.
+type Checkpoint struct {
+	Command   string            `json:"command"`
+	Flags     map[string]string `json:"flags"`
+	Done      int64             `json:"done"`      // every target below this index has completed
+	Completed []int64           `json:"completed"` // completed target indexes at or above Done
+	Finished  bool              `json:"finished"`  // the whole source was scanned
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// LoadCheckpoint reads a checkpoint written by a previous run. The returned
+// error wraps fs.ErrNotExist when there is nothing to resume.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+// Save atomically replaces the checkpoint file at path.
+func (cp *Checkpoint) Save(path string) error {
+	cp.UpdatedAt = time.Now()
+
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// skipCount returns how many targets the checkpoint already covers.
+func (cp *Checkpoint) skipCount() int64 {
+	return cp.Done + int64(len(cp.Completed))
+}
+
+// progressTracker records completed target indexes as a low watermark plus
+// the few indexes above it that finished out of order
+type progressTracker struct {
+	mu        sync.Mutex
+	done      int64
+	completed map[int64]struct{}
+	skip      map[int64]struct{} // completed above the watermark in a previous run
+	skipBelow int64              // everything below was completed in a previous run
+}
+
+func newProgressTracker(from *Checkpoint) *progressTracker {
+	t := &progressTracker{
+		completed: make(map[int64]struct{}),
+		skip:      make(map[int64]struct{}),
+	}
+	if from != nil {
+		t.skipBelow = from.Done
+		for _, idx := range from.Completed {
+			t.skip[idx] = struct{}{}
+		}
+	}
+	return t
+}
+
+// shouldSkip reports whether a previous run already scanned the target.
+func (t *progressTracker) shouldSkip(idx int64) bool {
+	if idx < t.skipBelow {
+		return true
+	}
+	_, ok := t.skip[idx]
+	return ok
+}
+
+// markDone records idx as completed and advances the watermark.
+func (t *progressTracker) markDone(idx int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.completed[idx] = struct{}{}
+	for {
+		if _, ok := t.completed[t.done]; !ok {
+			break
+		}
+		delete(t.completed, t.done)
+		t.done++
+	}
+}
+
+// fill copies the current progress into cp.
+func (t *progressTracker) fill(cp *Checkpoint) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cp.Done = t.done
+	cp.Completed = make([]int64, 0, len(t.completed))
+	for idx := range t.completed {
+		cp.Completed = append(cp.Completed, idx)
+	}
+	sort.Slice(cp.Completed, func(i, j int) bool { return cp.Completed[i] < cp.Completed[j] })
+}
@@ -0,0 +1,293 @@
+package queuescanner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pauseGate holds workers back while the scan is paused
+type pauseGate struct {
+	mu sync.Mutex
+	ch chan struct{} // open while paused, closed on resume
+}
+
+func (g *pauseGate) pause() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.ch == nil {
+		g.ch = make(chan struct{})
+	}
+}
+
+func (g *pauseGate) resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.ch != nil {
+		close(g.ch)
+		g.ch = nil
+	}
+}
+
+func (g *pauseGate) paused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.ch != nil
+}
+
+// wait blocks while paused, or until ctx is done.
+func (g *pauseGate) wait(ctx context.Context) error {
+	g.mu.Lock()
+	ch := g.ch
+	g.mu.Unlock()
+
+	if ch == nil {
+		return nil
+	}
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pause stops workers from starting new scans; scans in flight finish.
+func (qs *QueueScanner) Pause() {
+	qs.ctx.pause.pause()
+	qs.ctx.forceStat()
+}
+
+// Resume continues a paused scan.
+func (qs *QueueScanner) Resume() {
+	qs.ctx.pause.resume()
+	qs.ctx.forceStat()
+}
+
+// Paused reports whether the scan is paused.
+func (qs *QueueScanner) Paused() bool {
+	return qs.ctx.pause.paused()
+}
+
+// SetWorkers changes the number of workers of a running scan. With auto
+// threads the controller keeps tuning from the new value.
+func (qs *QueueScanner) SetWorkers(n int) {
+	qs.setWorkers(n)
+	qs.ctx.forceStat()
+}
+
+// Stop ends a running scan gracefully: no new targets are dispatched,
+// in-flight scans get the grace period, and output is flushed before Run
+// returns.
+func (qs *QueueScanner) Stop() {
+	if qs.stop != nil {
+		qs.stop()
+	}
+}
+
+// Stats returns a snapshot of the scan progress.
+func (qs *QueueScanner) Stats() Stats {
+	return qs.ctx.Stats()
+}
+
+// SetControlListen serves the HTTP/JSON control API while the scan runs.
+// addr is a loopback host:port, or unix:/path for a unix socket.
+func (qs *QueueScanner) SetControlListen(addr string) {
+	qs.controlAddr = addr
+}
+
+// controlProgress is the JSON form of Stats
+type controlProgress struct {
+	Total          int64            `json:"total"`
+	Completed      int64            `json:"completed"`
+	Success        int64            `json:"success"`
+	Failed         int64            `json:"failed"`
+	Failures       map[string]int64 `json:"failures"`
+	Retries        int64            `json:"retries"`
+	Resumed        int64            `json:"resumed"`
+	Dropped        map[string]int64 `json:"dropped"`
+	Percent        float64          `json:"percent"`
+	ElapsedSeconds float64          `json:"elapsed_seconds"`
+	ETASeconds     float64          `json:"eta_seconds"` // -1 if unknown
+	Speed          float64          `json:"speed"`
+	Rate           float64          `json:"rate"`
+	RateLimit      float64          `json:"rate_limit"`
+	Workers        int64            `json:"workers"`
+	Paused         bool             `json:"paused"`
+
+	Latency map[string]controlPercentiles `json:"latency"` // by Phase
+}
+
+// controlPercentiles is the JSON form of Percentiles, in milliseconds
+type controlPercentiles struct {
+	Count int64   `json:"count"`
+	P50   float64 `json:"p50_ms"`
+	P90   float64 `json:"p90_ms"`
+	P99   float64 `json:"p99_ms"`
+}
+
+func newControlProgress(s Stats) controlProgress {
+	p := controlProgress{
+		Total:          s.Total,
+		Completed:      s.Completed,
+		Success:        s.Success,
+		Failed:         s.Failed,
+		Failures:       make(map[string]int64),
+		Retries:        s.Retries,
+		Resumed:        s.Resumed,
+		Dropped:        make(map[string]int64),
+		Percent:        s.Percent,
+		ElapsedSeconds: s.Elapsed.Seconds(),
+		ETASeconds:     -1,
+		Speed:          s.Speed,
+		Rate:           s.Rate,
+		RateLimit:      s.RateLimit,
+		Workers:        s.Workers,
+		Paused:         s.Paused,
+		Latency:        make(map[string]controlPercentiles),
+	}
+	if s.ETA >= 0 {
+		p.ETASeconds = s.ETA.Seconds()
+	}
+	for _, class := range FailureClasses {
+		p.Failures[class.String()] = s.Failures[class]
+	}
+	for _, reason := range DropReasons {
+		p.Dropped[reason.String()] = s.Dropped[reason]
+	}
+	for _, phase := range Phases {
+		l := s.Latency[phase]
+		p.Latency[phase.String()] = controlPercentiles{
+			Count: l.Count,
+			P50:   milliseconds(l.P50),
+			P90:   milliseconds(l.P90),
+			P99:   milliseconds(l.P99),
+		}
+	}
+	return p
+}
+
+// ControlHandler returns the control API:
+//
+//	GET  /progress  current stats
+//	POST /pause     stop starting new scans
+//	POST /resume    continue a paused scan
+//	POST /workers   {"workers": n}
+//	POST /rate      {"rate": r, "burst": b}, rate 0 removes the limit
+//	POST /stop      graceful stop, flushing output
+//
+// Every endpoint answers with the progress after the change.
+func (qs *QueueScanner) ControlHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	progress := func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newControlProgress(qs.Stats()))
+	}
+	fail := func(w http.ResponseWriter, err error) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+	}
+
+	mux.HandleFunc("GET /progress", func(w http.ResponseWriter, r *http.Request) {
+		progress(w)
+	})
+	mux.HandleFunc("POST /pause", func(w http.ResponseWriter, r *http.Request) {
+		qs.Pause()
+		progress(w)
+	})
+	mux.HandleFunc("POST /resume", func(w http.ResponseWriter, r *http.Request) {
+		qs.Resume()
+		progress(w)
+	})
+	mux.HandleFunc("POST /workers", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Workers int `json:"workers"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			fail(w, err)
+			return
+		}
+		if req.Workers < 1 {
+			fail(w, fmt.Errorf("workers must be at least 1"))
+			return
+		}
+		qs.SetWorkers(req.Workers)
+		progress(w)
+	})
+	mux.HandleFunc("POST /rate", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Rate  float64 `json:"rate"`
+			Burst int     `json:"burst"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			fail(w, err)
+			return
+		}
+		if req.Rate < 0 {
+			fail(w, fmt.Errorf("rate must not be negative"))
+			return
+		}
+		qs.SetRateLimit(req.Rate, req.Burst)
+		qs.ctx.forceStat()
+		progress(w)
+	})
+	mux.HandleFunc("POST /stop", func(w http.ResponseWriter, r *http.Request) {
+		qs.Stop()
+		progress(w)
+	})
+
+	return mux
+}
+
+// listenControl opens a unix socket for "unix:/path", otherwise a TCP
+// listener that must be bound to a loopback address
+func listenControl(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		// Remove a socket left behind by a previous run, but not one a running
+		// scan still listens on
+		if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+			conn, err := net.DialTimeout("unix", path, time.Second)
+			if err == nil {
+				conn.Close()
+				return nil, fmt.Errorf("%s is in use by another scan", path)
+			}
+			if !isConnRefused(err) {
+				return nil, err
+			}
+			os.Remove(path)
+		}
+		return net.Listen("unix", path)
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if host != "localhost" {
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			return nil, fmt.Errorf("%s is not a loopback address; use 127.0.0.1:port or unix:/path", addr)
+		}
+	}
+	return net.Listen("tcp", addr)
+}
+
+// startControl serves the control API; the returned server is shut down by
+// the caller
+func (qs *QueueScanner) startControl() (*http.Server, error) {
+	ln, err := listenControl(qs.controlAddr)
+	if err != nil {
+		return nil, fmt.Errorf("control listener: %w", err)
+	}
+
+	srv := &http.Server{Handler: qs.ControlHandler(), ReadHeaderTimeout: 5 * time.Second}
+	go srv.Serve(ln)
+	return srv, nil
+}
@@ -0,0 +1,866 @@
+package queuescanner
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultBatchSize is the number of targets handed to a worker at once
+	DefaultBatchSize = 256
+	// DefaultLease is how long a worker may hold a batch without a heartbeat
+	// before it is handed to another worker
+	DefaultLease = 60 * time.Second
+
+	// coordinatorPrefetch is how many batches are read ahead of the workers
+	coordinatorPrefetch = 4
+	// coordinatorLinger is how long a finished coordinator keeps answering so
+	// its workers learn that the scan is over
+	coordinatorLinger = 3 * time.Second
+	// leasePollInterval is how often a worker asks again when no batch is
+	// available yet
+	leasePollInterval = time.Second
+)
+
+// Job tells workers what to run: a scan command and its arguments.
+type Job struct {
+	Command      string   `json:"command"`
+	Args         []string `json:"args"`
+	LeaseSeconds float64  `json:"lease_seconds"`
+}
+
+// CoordinatorOptions configures RunCoordinator.
+type CoordinatorOptions struct {
+	Job       Job
+	BatchSize int           // DefaultBatchSize if 0
+	Lease     time.Duration // DefaultLease if 0
+	Token     string        // required as a bearer token from workers, if set
+}
+
+// batch is a slice of targets leased to one worker at a time
+type batch struct {
+	ID       int64    `json:"id"`
+	Targets  []string `json:"targets"`
+	worker   string
+	deadline time.Time
+}
+
+// leaseResponse answers POST /lease: a batch, or Wait or Done
+type leaseResponse struct {
+	Batch *batch `json:"batch,omitempty"`
+	Wait  bool   `json:"wait,omitempty"`
+	Done  bool   `json:"done,omitempty"`
+}
+
+// completion is the body of POST /complete
+type completion struct {
+	Worker   string    `json:"worker"`
+	Batch    int64     `json:"batch"`
+	Results  []*Result `json:"results"`
+	Failures []*Result `json:"failures"`
+}
+
+// workerRequest is the body of POST /lease, /heartbeat and /release
+type workerRequest struct {
+	Worker  string  `json:"worker"`
+	Batches []int64 `json:"batches,omitempty"`
+}
+
+// coordinator hands out the targets of a scan in batches and collects the
+// results
+type coordinator struct {
+	qs   *QueueScanner
+	opts CoordinatorOptions
+
+	mu         sync.Mutex
+	queue      []*batch // waiting for a worker, re-issued batches first
+	leased     map[int64]*batch
+	workers    map[string]time.Time // last request by worker
+	told       map[string]bool      // workers told the scan is over
+	nextID     int64
+	sourceDone bool
+	sourceErr  error
+	stopping   bool
+
+	taken chan struct{} // a batch was leased, the feeder may read ahead
+	done  chan struct{} // every target was scanned
+	once  sync.Once
+}
+
+// StartCoordinator runs the coordinator until every target is scanned or
+// SIGINT/SIGTERM is received.
+func (qs *QueueScanner) StartCoordinator(addr string, opts CoordinatorOptions) Summary {
+	return withSignals(func(ctx context.Context) Summary {
+		return qs.RunCoordinator(ctx, addr, opts)
+	})
+}
+
+// RunCoordinator serves the targets of the scan on addr to workers instead
+// of scanning them itself. Workers lease batches of targets, renew their
+// leases with heartbeats and report the results of a batch once it is
+// done; batches of workers that stop reporting are handed out again. The
+// results are written and displayed as if scanned locally.
+//
+// On cancellation no further batches are handed out and leased ones get the
+// grace period to complete.
+func (qs *QueueScanner) RunCoordinator(ctx context.Context, addr string, opts CoordinatorOptions) Summary {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		qs.ctx.source.Close()
+		return Summary{Err: fmt.Errorf("coordinator listener: %w", err)}
+	}
+	return qs.serveCoordinator(ctx, ln, opts)
+}
+
+// serveCoordinator runs the coordinator on ln, which it closes
+func (qs *QueueScanner) serveCoordinator(ctx context.Context, ln net.Listener, opts CoordinatorOptions) Summary {
+	defer qs.ctx.source.Close()
+	defer ln.Close()
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = DefaultLease
+	}
+	opts.Job.LeaseSeconds = opts.Lease.Seconds()
+
+	c := &coordinator{
+		qs:      qs,
+		opts:    opts,
+		leased:  make(map[int64]*batch),
+		workers: make(map[string]time.Time),
+		told:    make(map[string]bool),
+		taken:   make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+
+	qs.prepareSource()
+	if err := qs.openWriters(); err != nil {
+		return Summary{Err: err}
+	}
+
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	qs.stop = stop
+
+	// Set up everything the stats read before workers, metrics and control
+	// clients can reach them
+	qs.ctx.baseCtx = ctx
+	qs.ctx.startTime = nowNano()
+
+	// No local workers: the pool only reports the number of remote ones
+	qs.draining = true
+	atomic.StoreInt64(&qs.ctx.workers, 0)
+
+	srv := &http.Server{Handler: c.handler(), ReadHeaderTimeout: 5 * time.Second}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	closeServers, err := qs.startServers()
+	if err != nil {
+		qs.ctx.closeWriter()
+		return Summary{Err: err}
+	}
+	defer closeServers()
+
+	qs.ctx.renderer.Start(qs.ctx.columns)
+	qs.ctx.LogStat()
+
+	go c.feed(ctx)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var deadline <-chan time.Time
+wait:
+	for {
+		select {
+		case <-c.done:
+			break wait
+		case <-ctx.Done():
+			if deadline == nil {
+				c.stop()
+				deadline = time.After(qs.gracePeriod)
+			}
+		case <-deadline:
+			break wait
+		case <-ticker.C:
+			c.expire()
+			qs.ctx.LogStat()
+		}
+		if deadline != nil && c.outstanding() == 0 {
+			break wait
+		}
+	}
+
+	c.mu.Lock()
+	c.stopping = true
+	sourceErr := c.sourceErr
+	interrupted := ctx.Err() != nil || sourceErr != nil || len(c.leased) > 0 || len(c.queue) > 0
+	c.mu.Unlock()
+	atomic.StoreInt32(&qs.ctx.finished, 1)
+
+	summary := qs.finish(interrupted, sourceErr)
+	c.linger()
+	return summary
+}
+
+// feed reads batches from the source, staying a few batches ahead of the
+// workers
+func (c *coordinator) feed(ctx context.Context) {
+	var count int64
+	for {
+		for c.queued() >= coordinatorPrefetch {
+			select {
+			case <-c.taken:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		targets := make([]string, 0, c.opts.BatchSize)
+		var err error
+		for len(targets) < c.opts.BatchSize {
+			var target string
+			target, err = c.qs.ctx.source.Next()
+			if err != nil {
+				break
+			}
+			targets = append(targets, target)
+		}
+		count += int64(len(targets))
+
+		c.mu.Lock()
+		if len(targets) > 0 {
+			c.nextID++
+			c.queue = append(c.queue, &batch{ID: c.nextID, Targets: targets})
+		}
+		if err != nil {
+			c.sourceDone = true
+			if err == io.EOF {
+				// The exact total is known now, replace the estimate
+				atomic.StoreInt64(&c.qs.ctx.total, count)
+			} else {
+				c.sourceErr = err
+			}
+			c.checkDone()
+		}
+		c.mu.Unlock()
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *coordinator) queued() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.queue)
+}
+
+func (c *coordinator) outstanding() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.leased)
+}
+
+// stop hands out no more batches
+func (c *coordinator) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopping = true
+}
+
+// checkDone closes done once every batch has been completed; c.mu is held
+func (c *coordinator) checkDone() {
+	if c.sourceDone && len(c.queue) == 0 && len(c.leased) == 0 {
+		c.once.Do(func() { close(c.done) })
+	}
+}
+
+// expire hands the batches of workers past their lease to other workers and
+// updates the number of active workers
+func (c *coordinator) expire() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for id, b := range c.leased {
+		if now.After(b.deadline) {
+			delete(c.leased, id)
+			b.worker = ""
+			c.queue = append([]*batch{b}, c.queue...)
+		}
+	}
+
+	active := 0
+	for worker, seen := range c.workers {
+		if now.Sub(seen) > c.opts.Lease {
+			delete(c.workers, worker)
+			continue
+		}
+		active++
+	}
+	atomic.StoreInt64(&c.qs.ctx.workers, int64(active))
+}
+
+// lease hands the next batch to worker
+func (c *coordinator) lease(worker string) leaseResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.seen(worker)
+	if c.stopping || c.sourceErr != nil {
+		c.told[worker] = true
+		return leaseResponse{Done: true}
+	}
+	if len(c.queue) == 0 {
+		if c.sourceDone && len(c.leased) == 0 {
+			c.told[worker] = true
+			return leaseResponse{Done: true}
+		}
+		// Leased batches may still come back if their worker disappears
+		return leaseResponse{Wait: true}
+	}
+	if c.qs.ctx.pause.paused() {
+		return leaseResponse{Wait: true}
+	}
+
+	b := c.queue[0]
+	c.queue = c.queue[1:]
+	b.worker = worker
+	b.deadline = time.Now().Add(c.opts.Lease)
+	c.leased[b.ID] = b
+	atomic.AddInt64(&c.qs.ctx.started, int64(len(b.Targets)))
+
+	select {
+	case c.taken <- struct{}{}:
+	default:
+	}
+	return leaseResponse{Batch: b}
+}
+
+// heartbeat extends the leases of worker and returns the batches it no
+// longer holds
+func (c *coordinator) heartbeat(worker string, ids []int64) []int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.seen(worker)
+	lost := []int64{}
+	for _, id := range ids {
+		b, ok := c.leased[id]
+		if !ok || b.worker != worker {
+			lost = append(lost, id)
+			continue
+		}
+		b.deadline = time.Now().Add(c.opts.Lease)
+	}
+	return lost
+}
+
+// release puts batches that worker gave up back in the queue
+func (c *coordinator) release(worker string, ids []int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.seen(worker)
+	for _, id := range ids {
+		if b, ok := c.leased[id]; ok && b.worker == worker {
+			delete(c.leased, id)
+			b.worker = ""
+			c.queue = append([]*batch{b}, c.queue...)
+		}
+	}
+}
+
+// complete records the results of a batch. It reports false when the batch
+// was already completed by another worker.
+func (c *coordinator) complete(done *completion) bool {
+	c.mu.Lock()
+	c.seen(done.Worker)
+	b, ok := c.leased[done.Batch]
+	if !ok {
+		// A re-issued batch still waiting in the queue may be completed by
+		// the worker it was taken from
+		for i, q := range c.queue {
+			if q.ID == done.Batch {
+				b, ok = q, true
+				c.queue = append(c.queue[:i], c.queue[i+1:]...)
+				break
+			}
+		}
+	}
+	delete(c.leased, done.Batch)
+	c.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	for _, res := range done.Results {
+		c.qs.ctx.ScanSuccess(res)
+	}
+	for _, res := range done.Failures {
+		c.qs.ctx.addFailure(ParseFailureClass(res.ErrorClass), res)
+	}
+	atomic.AddInt64(&c.qs.ctx.ScanComplete, int64(len(b.Targets)))
+	c.qs.ctx.LogStat()
+
+	c.mu.Lock()
+	c.checkDone()
+	c.mu.Unlock()
+	return true
+}
+
+// seen records a request by worker; c.mu is held
+func (c *coordinator) seen(worker string) {
+	if _, ok := c.workers[worker]; !ok {
+		c.workers[worker] = time.Now()
+		atomic.StoreInt64(&c.qs.ctx.workers, int64(len(c.workers)))
+		return
+	}
+	c.workers[worker] = time.Now()
+}
+
+// linger keeps serving until every active worker was told that the scan is
+// over, for at most coordinatorLinger
+func (c *coordinator) linger() {
+	deadline := time.Now().Add(coordinatorLinger)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		waiting := 0
+		for worker := range c.workers {
+			if !c.told[worker] {
+				waiting++
+			}
+		}
+		c.mu.Unlock()
+		if waiting == 0 {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// handler returns the coordinator API used by workers:
+//
+//	GET  /job        the command to run
+//	POST /lease      {"worker": id}, answered with a batch, wait or done
+//	POST /heartbeat  {"worker": id, "batches": [...]}, renews the leases
+//	POST /complete   the results of a batch
+//	POST /release    {"worker": id, "batches": [...]}, gives batches back
+func (c *coordinator) handler() http.Handler {
+	mux := http.NewServeMux()
+
+	reply := func(w http.ResponseWriter, status int, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(v)
+	}
+	fail := func(w http.ResponseWriter, status int, err error) {
+		reply(w, status, map[string]string{"error": err.Error()})
+	}
+	decode := func(w http.ResponseWriter, r *http.Request, v any) bool {
+		if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+			fail(w, http.StatusBadRequest, err)
+			return false
+		}
+		return true
+	}
+	worker := func(w http.ResponseWriter, r *http.Request) (workerRequest, bool) {
+		var req workerRequest
+		if !decode(w, r, &req) {
+			return req, false
+		}
+		if req.Worker == "" {
+			fail(w, http.StatusBadRequest, errors.New("missing worker id"))
+			return req, false
+		}
+		return req, true
+	}
+
+	mux.HandleFunc("GET /job", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, http.StatusOK, c.opts.Job)
+	})
+	mux.HandleFunc("POST /lease", func(w http.ResponseWriter, r *http.Request) {
+		if req, ok := worker(w, r); ok {
+			reply(w, http.StatusOK, c.lease(req.Worker))
+		}
+	})
+	mux.HandleFunc("POST /heartbeat", func(w http.ResponseWriter, r *http.Request) {
+		if req, ok := worker(w, r); ok {
+			reply(w, http.StatusOK, map[string][]int64{"lost": c.heartbeat(req.Worker, req.Batches)})
+		}
+	})
+	mux.HandleFunc("POST /release", func(w http.ResponseWriter, r *http.Request) {
+		if req, ok := worker(w, r); ok {
+			c.release(req.Worker, req.Batches)
+			reply(w, http.StatusOK, map[string]bool{"ok": true})
+		}
+	})
+	mux.HandleFunc("POST /complete", func(w http.ResponseWriter, r *http.Request) {
+		var done completion
+		if !decode(w, r, &done) {
+			return
+		}
+		if !c.complete(&done) {
+			fail(w, http.StatusConflict, fmt.Errorf("batch %d is not leased", done.Batch))
+			return
+		}
+		reply(w, http.StatusOK, map[string]bool{"ok": true})
+	})
+
+	if c.opts.Token == "" {
+		return mux
+	}
+	want := []byte("Bearer " + c.opts.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			fail(w, http.StatusUnauthorized, errors.New("invalid token"))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// CoordinatorClient connects a worker to a coordinator. Set on a scanner
+// with SetCoordinator, it replaces the target source and the output: targets
+// are leased from the coordinator in batches and the results of each batch
+// are sent back once every target in it was scanned.
+type CoordinatorClient struct {
+	url    string
+	token  string
+	worker string
+	client *http.Client
+	job    Job
+	lease  time.Duration
+
+	ctx     context.Context
+	stopped chan struct{}
+	wg      sync.WaitGroup
+
+	mu      sync.Mutex
+	current *workerBatch           // batch whose targets are being queued
+	next    int                    // next target of current
+	index   int64                  // queue index of the next target
+	items   map[int64]*workerBatch // batch of each queued target not yet scanned
+	batches map[int64]*workerBatch
+	err     error
+}
+
+// workerBatch is a batch leased by this worker
+type workerBatch struct {
+	id        int64
+	targets   []string
+	remaining int
+	results   []*Result
+	failures  []*Result
+}
+
+// DialCoordinator fetches the job from the coordinator at url. worker
+// identifies this process in the coordinator's leases.
+func DialCoordinator(url, token, worker string) (*CoordinatorClient, error) {
+	c := &CoordinatorClient{
+		url:     strings.TrimRight(url, "/"),
+		token:   token,
+		worker:  worker,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		ctx:     context.Background(),
+		stopped: make(chan struct{}),
+		items:   make(map[int64]*workerBatch),
+		batches: make(map[int64]*workerBatch),
+	}
+
+	if err := c.call(http.MethodGet, "/job", nil, &c.job); err != nil {
+		return nil, fmt.Errorf("fetching job from %s: %w", url, err)
+	}
+	if c.job.Command == "" {
+		return nil, fmt.Errorf("%s sent no job", url)
+	}
+	c.lease = time.Duration(c.job.LeaseSeconds * float64(time.Second))
+	if c.lease <= 0 {
+		c.lease = DefaultLease
+	}
+	return c, nil
+}
+
+// Job returns the job sent by the coordinator.
+func (c *CoordinatorClient) Job() Job {
+	return c.job
+}
+
+// SetCoordinator makes the scanner a worker of the coordinator behind
+// client. Normalisation, order, shard and output files are left to the
+// coordinator.
+func (qs *QueueScanner) SetCoordinator(client *CoordinatorClient) {
+	qs.remote = client
+}
+
+// errStatus is an unexpected answer of the coordinator
+type errStatus struct {
+	status int
+	msg    string
+}
+
+func (e *errStatus) Error() string {
+	return fmt.Sprintf("coordinator answered %d: %s", e.status, e.msg)
+}
+
+// call sends a request to the coordinator and decodes the answer into out
+func (c *CoordinatorClient) call(method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.url+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var answer struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&answer)
+		return &errStatus{status: resp.StatusCode, msg: answer.Error}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// retry calls the coordinator until it answers, for at most one lease
+// period, so a restart or a network hiccup does not end the worker
+func (c *CoordinatorClient) retry(path string, in, out any) error {
+	deadline := time.Now().Add(c.lease)
+	for {
+		err := c.call(http.MethodPost, path, in, out)
+		var status *errStatus
+		if err == nil || errors.As(err, &status) || time.Now().After(deadline) {
+			return err
+		}
+		select {
+		case <-time.After(leasePollInterval):
+		case <-c.ctx.Done():
+			return c.ctx.Err()
+		}
+	}
+}
+
+// start sends heartbeats for the leased batches until Close
+func (c *CoordinatorClient) start(ctx context.Context) {
+	c.ctx = ctx
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		ticker := time.NewTicker(c.lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				// A missed heartbeat is made up by the next one
+				c.call(http.MethodPost, "/heartbeat", workerRequest{Worker: c.worker, Batches: c.held()}, nil)
+			case <-c.stopped:
+				return
+			}
+		}
+	}()
+}
+
+// held returns the ids of the batches not yet completed
+func (c *CoordinatorClient) held() []int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ids := make([]int64, 0, len(c.batches))
+	for id := range c.batches {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Next returns the next target, leasing a new batch when the current one
+// is used up. It returns io.EOF once the coordinator has no more work.
+func (c *CoordinatorClient) Next() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return "", c.err
+	}
+	for c.current == nil || c.next >= len(c.current.targets) {
+		c.mu.Unlock()
+		b, err := c.leaseBatch()
+		c.mu.Lock()
+		if err != nil {
+			return "", err
+		}
+		c.current, c.next = b, 0
+	}
+
+	target := c.current.targets[c.next]
+	c.next++
+	c.items[c.index] = c.current
+	c.index++
+	return target, nil
+}
+
+// leaseBatch asks the coordinator for a batch until it hands one out or
+// says the scan is over
+func (c *CoordinatorClient) leaseBatch() (*workerBatch, error) {
+	for {
+		var resp leaseResponse
+		if err := c.retry("/lease", workerRequest{Worker: c.worker}, &resp); err != nil {
+			if c.ctx.Err() != nil {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("leasing a batch: %w", err)
+		}
+
+		switch {
+		case resp.Done:
+			return nil, io.EOF
+		case resp.Batch != nil && len(resp.Batch.Targets) > 0:
+			b := &workerBatch{
+				id:        resp.Batch.ID,
+				targets:   resp.Batch.Targets,
+				remaining: len(resp.Batch.Targets),
+			}
+			c.mu.Lock()
+			c.batches[b.id] = b
+			c.mu.Unlock()
+			return b, nil
+		}
+
+		select {
+		case <-time.After(leasePollInterval):
+		case <-c.ctx.Done():
+			return nil, io.EOF
+		}
+	}
+}
+
+// Total is unknown to a worker.
+func (c *CoordinatorClient) Total() int64 { return -1 }
+
+// Close stops the heartbeats and gives the batches not completed back to
+// the coordinator.
+func (c *CoordinatorClient) Close() error {
+	select {
+	case <-c.stopped:
+		return nil
+	default:
+		close(c.stopped)
+	}
+	c.wg.Wait()
+
+	ids := c.held()
+	if len(ids) == 0 {
+		return nil
+	}
+	return c.call(http.MethodPost, "/release", workerRequest{Worker: c.worker, Batches: ids}, nil)
+}
+
+// completed is called once the target queued at index was scanned. The
+// batch is sent to the coordinator when it was the last one pending.
+func (c *CoordinatorClient) completed(index int64) {
+	c.mu.Lock()
+	b, ok := c.items[index]
+	if !ok {
+		c.mu.Unlock()
+		return
+	}
+	delete(c.items, index)
+
+	b.remaining--
+	if b.remaining > 0 {
+		c.mu.Unlock()
+		return
+	}
+	delete(c.batches, b.id)
+	c.mu.Unlock()
+
+	done := &completion{Worker: c.worker, Batch: b.id, Results: b.results, Failures: b.failures}
+	err := c.retry("/complete", done, nil)
+	var status *errStatus
+	if errors.As(err, &status) && status.status == http.StatusConflict {
+		// Another worker completed the batch after our lease ran out
+		return
+	}
+	if err != nil && c.ctx.Err() == nil {
+		c.mu.Lock()
+		if c.err == nil {
+			c.err = fmt.Errorf("sending batch %d: %w", b.id, err)
+		}
+		c.mu.Unlock()
+	}
+}
+
+// add attaches a result to the batch of the target queued at index
+func (c *CoordinatorClient) add(index int64, res *Result, failure bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, ok := c.items[index]
+	if !ok {
+		return
+	}
+	if failure {
+		b.failures = append(b.failures, res)
+	} else {
+		b.results = append(b.results, res)
+	}
+}
+
+// resultWriter returns a ResultWriter collecting results for the coordinator
+func (c *CoordinatorClient) resultWriter(failure bool) ResultWriter {
+	return &remoteWriter{client: c, failure: failure}
+}
+
+// remoteWriter hands results to the batch of the target they were found
+// for
+type remoteWriter struct {
+	client  *CoordinatorClient
+	failure bool
+}
+
+func (w *remoteWriter) writeItem(index int64, res *Result) error {
+	w.client.add(index, res, w.failure)
+	return nil
+}
+
+// Write drops res: a result outside a scan belongs to no batch.
+func (w *remoteWriter) Write(res *Result) error { return nil }
+
+func (w *remoteWriter) Flush() error { return nil }
+func (w *remoteWriter) Close() error { return nil }
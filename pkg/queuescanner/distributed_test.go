@@ -0,0 +1,276 @@
+package queuescanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testCoordinator serves targets on a loopback port and collects the hits
+// in a jsonl file
+type testCoordinator struct {
+	url     string
+	output  string
+	summary chan Summary
+}
+
+func startTestCoordinator(t *testing.T, ctx context.Context, targets []string, opts CoordinatorOptions) *testCoordinator {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tc := &testCoordinator{
+		url:     "http://" + ln.Addr().String(),
+		output:  filepath.Join(t.TempDir(), "hits.jsonl"),
+		summary: make(chan Summary, 1),
+	}
+
+	qs := New(1, nil)
+	qs.SetRenderer(NewSilentRenderer(io.Discard))
+	if err := qs.SetOutputFormat(OutputJSONLines); err != nil {
+		t.Fatal(err)
+	}
+	qs.SetOptions(NewSliceSource(targets), tc.output, 1)
+	go func() {
+		tc.summary <- qs.serveCoordinator(ctx, ln, opts)
+	}()
+	return tc
+}
+
+// wait returns the summary of the coordinator once the scan is over
+func (tc *testCoordinator) wait(t *testing.T) Summary {
+	t.Helper()
+	select {
+	case summary := <-tc.summary:
+		return summary
+	case <-time.After(30 * time.Second):
+		t.Fatal("coordinator did not finish")
+		return Summary{}
+	}
+}
+
+// hits returns the targets of the results written by the coordinator
+func (tc *testCoordinator) hits(t *testing.T) []string {
+	t.Helper()
+	data, err := os.ReadFile(tc.output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var targets []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var res Result
+		if err := json.Unmarshal(scanner.Bytes(), &res); err != nil {
+			t.Fatalf("bad result line %q: %v", scanner.Text(), err)
+		}
+		targets = append(targets, res.Target)
+	}
+	return targets
+}
+
+// scanLog counts how often each target was scanned, across workers
+type scanLog struct {
+	mu      sync.Mutex
+	count   map[string]int
+	rewrite func(target string) string // reported Target, if set
+}
+
+func (l *scanLog) scan(c *Ctx, target string) error {
+	l.mu.Lock()
+	l.count[target]++
+	l.mu.Unlock()
+
+	reported := target
+	if l.rewrite != nil {
+		reported = l.rewrite(target)
+	}
+	c.ScanSuccess(&Result{Target: reported})
+	return nil
+}
+
+// runTestWorkers runs n workers of the coordinator at url until it has no
+// more work
+func runTestWorkers(t *testing.T, ctx context.Context, url string, n int, log *scanLog) {
+	t.Helper()
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		client, err := DialCoordinator(url, "", fmt.Sprintf("worker-%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		qs := New(4, log.scan)
+		qs.SetRenderer(NewSilentRenderer(io.Discard))
+		qs.SetOptions(NewSliceSource(nil), "", 1)
+		qs.SetCoordinator(client)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if summary := qs.Run(ctx); summary.Err != nil {
+				t.Errorf("worker: %v", summary.Err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func testTargets(n int) []string {
+	targets := make([]string, n)
+	for i := range targets {
+		targets[i] = fmt.Sprintf("host-%03d.example", i)
+	}
+	return targets
+}
+
+// checkScannedOnce fails unless every target was scanned and reported
+// exactly once
+func checkScannedOnce(t *testing.T, targets []string, log *scanLog, hits []string) {
+	t.Helper()
+
+	for _, target := range targets {
+		if n := log.count[target]; n != 1 {
+			t.Errorf("%s scanned %d times, want 1", target, n)
+		}
+	}
+	if len(log.count) != len(targets) {
+		t.Errorf("%d distinct targets scanned, want %d", len(log.count), len(targets))
+	}
+
+	reported := make(map[string]int)
+	for _, target := range hits {
+		reported[target]++
+	}
+	for _, target := range targets {
+		if n := reported[target]; n != 1 {
+			t.Errorf("%s reported %d times, want 1", target, n)
+		}
+	}
+	if len(hits) != len(targets) {
+		t.Errorf("%d results collected, want %d", len(hits), len(targets))
+	}
+}
+
+func TestCoordinatorScansEveryTargetOnce(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	targets := testTargets(100)
+	tc := startTestCoordinator(t, ctx, targets, CoordinatorOptions{Job: Job{Command: "test"}, BatchSize: 7})
+
+	log := &scanLog{count: make(map[string]int)}
+	runTestWorkers(t, ctx, tc.url, 3, log)
+
+	summary := tc.wait(t)
+	if summary.Err != nil || summary.Interrupted {
+		t.Fatalf("coordinator ended with err=%v interrupted=%v", summary.Err, summary.Interrupted)
+	}
+	if summary.Completed != int64(len(targets)) || summary.Success != int64(len(targets)) {
+		t.Errorf("summary completed=%d success=%d, want %d", summary.Completed, summary.Success, len(targets))
+	}
+	checkScannedOnce(t, targets, log, tc.hits(t))
+}
+
+func TestCoordinatorCollectsResultsWithRewrittenTarget(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Like sni --connect-ip, which queues host@ip and reports the host
+	hosts := testTargets(20)
+	var targets []string
+	for _, host := range hosts {
+		targets = append(targets, host+"@192.0.2.1", host+"@192.0.2.2")
+	}
+	tc := startTestCoordinator(t, ctx, targets, CoordinatorOptions{Job: Job{Command: "test"}, BatchSize: 6})
+
+	log := &scanLog{count: make(map[string]int), rewrite: func(target string) string {
+		host, _, _ := strings.Cut(target, "@")
+		return host
+	}}
+	runTestWorkers(t, ctx, tc.url, 2, log)
+
+	summary := tc.wait(t)
+	if summary.Err != nil || summary.Interrupted {
+		t.Fatalf("coordinator ended with err=%v interrupted=%v", summary.Err, summary.Interrupted)
+	}
+
+	reported := make(map[string]int)
+	for _, host := range tc.hits(t) {
+		reported[host]++
+	}
+	for _, host := range hosts {
+		if n := reported[host]; n != 2 {
+			t.Errorf("%s reported %d times, want 2", host, n)
+		}
+	}
+	if summary.Success != int64(len(targets)) {
+		t.Errorf("summary success=%d, want %d", summary.Success, len(targets))
+	}
+}
+
+func TestCoordinatorReissuesBatchOfLostWorker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	targets := testTargets(30)
+	tc := startTestCoordinator(t, ctx, targets, CoordinatorOptions{Job: Job{Command: "test"}, BatchSize: 5, Lease: time.Second})
+
+	// A worker leases a batch and disappears without a heartbeat or release
+	lost := leaseAsGhost(t, tc.url, "ghost")
+
+	log := &scanLog{count: make(map[string]int)}
+	runTestWorkers(t, ctx, tc.url, 2, log)
+
+	summary := tc.wait(t)
+	if summary.Err != nil || summary.Interrupted {
+		t.Fatalf("coordinator ended with err=%v interrupted=%v", summary.Err, summary.Interrupted)
+	}
+	for _, target := range lost.Targets {
+		if log.count[target] == 0 {
+			t.Errorf("%s of the lost batch was never scanned", target)
+		}
+	}
+	checkScannedOnce(t, targets, log, tc.hits(t))
+}
+
+// leaseAsGhost leases a batch like a worker would, until one is handed out
+func leaseAsGhost(t *testing.T, url, worker string) *batch {
+	t.Helper()
+
+	body, _ := json.Marshal(workerRequest{Worker: worker})
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		resp, err := http.Post(url+"/lease", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var answer leaseResponse
+		err = json.NewDecoder(resp.Body).Decode(&answer)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if answer.Batch != nil {
+			return answer.Batch
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("no batch was handed out")
+	return nil
+}
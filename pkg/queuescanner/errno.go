@@ -0,0 +1,23 @@
+//go:build unix || windows
+
+package queuescanner
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isConnRefused reports whether err is a refused connection
+func isConnRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// isCongestionErrno reports whether err is a reset connection or the local
+// host running out of sockets or buffers
+func isCongestionErrno(err error) bool {
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EMFILE) ||
+		errors.Is(err, syscall.ENOBUFS) ||
+		errors.Is(err, syscall.EADDRNOTAVAIL)
+}
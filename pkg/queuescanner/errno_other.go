@@ -0,0 +1,26 @@
+//go:build !unix && !windows
+
+package queuescanner
+
+import "strings"
+
+// isConnRefused reports whether err is a refused connection. There are no
+// errno values here, so the message is matched.
+func isConnRefused(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "connection refused")
+}
+
+// isCongestionErrno reports whether err is a reset connection or the local
+// host running out of sockets or buffers
+func isCongestionErrno(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	for _, s := range []string{"connection reset", "connection aborted", "too many open files", "no buffer space", "address not available"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
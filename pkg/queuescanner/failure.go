@@ -0,0 +1,150 @@
+package queuescanner
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+)
+
+// FailureClass says why a target was not a hit.
+type FailureClass int
+
+const (
+	FailureOther FailureClass = iota
+	FailureDNS
+	FailureConnectRefused
+	FailureConnectTimeout
+	FailureTLSHandshake
+	FailureReadTimeout
+	FailureUnexpectedStatus
+	FailureFiltered
+	FailureCertificate
+
+	numFailureClasses
+)
+
+var failureNames = [numFailureClasses]string{
+	"other",
+	"dns_error",
+	"connect_refused",
+	"connect_timeout",
+	"tls_handshake",
+	"read_timeout",
+	"unexpected_status",
+	"filtered",
+	"cert_invalid",
+}
+
+var failureLabels = [numFailureClasses]string{
+	"Other",
+	"DNS error",
+	"Connect refused",
+	"Connect timeout",
+	"TLS handshake failure",
+	"Read timeout",
+	"Unexpected status",
+	"Skipped by filter",
+	"Invalid certificate",
+}
+
+// FailureClasses lists every class in display order.
+var FailureClasses = []FailureClass{
+	FailureDNS,
+	FailureConnectRefused,
+	FailureConnectTimeout,
+	FailureTLSHandshake,
+	FailureCertificate,
+	FailureReadTimeout,
+	FailureUnexpectedStatus,
+	FailureFiltered,
+	FailureOther,
+}
+
+// String returns the machine readable name used in output files.
+func (c FailureClass) String() string {
+	if c < 0 || c >= numFailureClasses {
+		return failureNames[FailureOther]
+	}
+	return failureNames[c]
+}
+
+// ParseFailureClass returns the class with the given machine readable name,
+// or FailureOther if there is none.
+func ParseFailureClass(name string) FailureClass {
+	for class, n := range failureNames {
+		if n == name {
+			return FailureClass(class)
+		}
+	}
+	return FailureOther
+}
+
+// Label returns the human readable name used in the dashboard.
+func (c FailureClass) Label() string {
+	if c < 0 || c >= numFailureClasses {
+		return failureLabels[FailureOther]
+	}
+	return failureLabels[c]
+}
+
+// Failure is an error tagged with its class by the scan function.
+type Failure struct {
+	Class FailureClass
+	Err   error
+	TLS   *TLSInfo // handshake of the failed probe, e.g. with its certificate status
+}
+
+func (f *Failure) Error() string {
+	return f.Err.Error()
+}
+
+func (f *Failure) Unwrap() error {
+	return f.Err
+}
+
+// Fail tags err with a failure class. Scan functions use it where the class
+// cannot be told from the error alone, e.g. a handshake or a status check.
+func Fail(class FailureClass, err error) error {
+	if err == nil {
+		err = errors.New(class.Label())
+	}
+	return &Failure{Class: class, Err: err}
+}
+
+// ClassifyError returns the failure class of an error returned by a scan
+// function: the class given to Fail, or else one guessed from the error.
+func ClassifyError(err error) FailureClass {
+	var failure *Failure
+	if errors.As(err, &failure) {
+		return failure.Class
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return FailureDNS
+	}
+
+	if isConnRefused(err) {
+		return FailureConnectRefused
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" && opErr.Timeout() {
+		return FailureConnectTimeout
+	}
+
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var verifyErr *tls.CertificateVerificationError
+	if errors.As(err, &recordErr) || errors.As(err, &alertErr) || errors.As(err, &verifyErr) {
+		return FailureTLSHandshake
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return FailureReadTimeout
+	}
+
+	return FailureOther
+}
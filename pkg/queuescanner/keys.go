@@ -0,0 +1,160 @@
+package queuescanner
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// interactiveRenderer is a Renderer that can be driven from the keyboard
+type interactiveRenderer interface {
+	setRaw(raw bool)
+	toggleFailures() bool
+	notify(msg string)
+}
+
+// keyPollInterval is how often the key reader checks whether the scan has
+// ended while no key is pressed
+const keyPollInterval = 100 * time.Millisecond
+
+// startKeys puts the terminal into raw mode and handles key presses while the
+// scan runs. It does nothing unless stdin is a terminal and the renderer is
+// the dashboard. The returned function stops the key reader and restores the
+// terminal, so the next dashboard gets every key pressed after it.
+func (qs *QueueScanner) startKeys() func() {
+	r, ok := qs.ctx.renderer.(interactiveRenderer)
+	fd := int(os.Stdin.Fd())
+	if !ok || !term.IsTerminal(fd) {
+		return func() {}
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return func() {}
+	}
+	r.setRaw(true)
+
+	var restoreOnce sync.Once
+	restoreTerm := func() {
+		restoreOnce.Do(func() {
+			term.Restore(fd, state)
+			r.setRaw(false)
+		})
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		qs.readKeys(r, restoreTerm, done)
+	}()
+
+	var stopOnce sync.Once
+	return func() {
+		stopOnce.Do(func() {
+			close(done)
+			<-stopped
+		})
+		restoreTerm()
+	}
+}
+
+// readKeys handles key presses until stdin fails or done is closed. It only
+// reads once a key is waiting, so it never blocks past done. If stdin fails,
+// the terminal is restored so Ctrl+C interrupts the scan again.
+func (qs *QueueScanner) readKeys(r interactiveRenderer, restore func(), done <-chan struct{}) {
+	buf := make([]byte, 16)
+	for {
+		ready, err := waitKey(os.Stdin, keyPollInterval)
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if err != nil {
+			restore()
+			return
+		}
+		if !ready {
+			continue
+		}
+
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			restore()
+			return
+		}
+		if atomic.LoadInt32(&qs.ctx.finished) != 0 {
+			return
+		}
+		for _, key := range buf[:n] {
+			qs.handleKey(r, key, restore)
+		}
+	}
+}
+
+func (qs *QueueScanner) handleKey(r interactiveRenderer, key byte, restore func()) {
+	switch key {
+	case 'p', 'P', ' ':
+		if qs.Paused() {
+			qs.Resume()
+		} else {
+			qs.Pause()
+		}
+
+	case '+', '=':
+		n := qs.workerCount()
+		qs.SetWorkers(n + threadStep(n))
+
+	case '-', '_':
+		n := qs.workerCount()
+		qs.SetWorkers(n - threadStep(n))
+
+	case 's', 'S':
+		switch err := qs.SaveSnapshot(); {
+		case err != nil:
+			r.notify(fmt.Sprintf("Saving results failed: %v", err))
+		case qs.ctx.OutputFile == "":
+			r.notify("No output file set (-o), nothing to save")
+		default:
+			r.notify("Results saved to " + qs.ctx.OutputFile)
+		}
+		qs.ctx.forceStat()
+
+	case 'f', 'F':
+		if r.toggleFailures() {
+			r.notify("Showing failures")
+		} else {
+			r.notify("Hiding failures")
+		}
+		qs.ctx.forceStat()
+
+	case 'q', 'Q', 3: // 3 is Ctrl+C, which raw mode no longer turns into SIGINT
+		// A second Ctrl+C during the grace period terminates, like a second signal
+		if key == 3 && qs.ctx.Context().Err() != nil {
+			restore()
+			os.Exit(130)
+		}
+		r.notify("Stopping, waiting for scans in flight...")
+		qs.ctx.forceStat()
+		qs.Stop()
+	}
+}
+
+// threadStep is how many workers + and - add or remove
+func threadStep(n int) int {
+	return max(1, n/10)
+}
+
+// SaveSnapshot flushes the hits and failures found so far to the output
+// files and, for a resumable scan, saves the checkpoint.
+func (qs *QueueScanner) SaveSnapshot() error {
+	if qs.checkpointPath != "" {
+		return qs.saveCheckpoint(false)
+	}
+	return qs.ctx.flushWriter()
+}
@@ -0,0 +1,15 @@
+//go:build !unix && !windows
+
+package queuescanner
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// waitKey fails, as there is no way to poll f here; the key reader then
+// stops and keyboard controls are off
+func waitKey(f *os.File, timeout time.Duration) (bool, error) {
+	return false, errors.New("keyboard controls are not supported on this platform")
+}
@@ -0,0 +1,126 @@
+package queuescanner
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the scan duration histogram
+var latencyBuckets = [...]float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// histogram counts observations into latencyBuckets without locking
+type histogram struct {
+	counts [len(latencyBuckets) + 1]int64 // one per bucket plus +Inf, non-cumulative
+	sum    int64                          // nanoseconds
+}
+
+func (h *histogram) observe(d time.Duration) {
+	i := 0
+	for i < len(latencyBuckets) && d.Seconds() > latencyBuckets[i] {
+		i++
+	}
+	atomic.AddInt64(&h.counts[i], 1)
+	atomic.AddInt64(&h.sum, int64(d))
+}
+
+// write appends the histogram in Prometheus text format
+func (h *histogram) write(b *bytes.Buffer, name, labels string) {
+	var cumulative int64
+	for i, le := range latencyBuckets {
+		cumulative += atomic.LoadInt64(&h.counts[i])
+		fmt.Fprintf(b, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, strconv.FormatFloat(le, 'f', -1, 64), cumulative)
+	}
+	cumulative += atomic.LoadInt64(&h.counts[len(latencyBuckets)])
+	fmt.Fprintf(b, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, cumulative)
+	fmt.Fprintf(b, "%s_sum{%s} %g\n", name, labels, time.Duration(atomic.LoadInt64(&h.sum)).Seconds())
+	fmt.Fprintf(b, "%s_count{%s} %d\n", name, labels, cumulative)
+}
+
+// SetMetricsListen serves Prometheus metrics on addr at /metrics while the
+// scan runs.
+func (qs *QueueScanner) SetMetricsListen(addr string) {
+	qs.metricsAddr = addr
+}
+
+// MetricsHandler returns an http.Handler exposing the scan metrics in the
+// Prometheus text format.
+func (qs *QueueScanner) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(qs.metrics())
+	})
+}
+
+// startMetrics listens on the metrics address; the returned server is shut
+// down by the caller
+func (qs *QueueScanner) startMetrics() (*http.Server, error) {
+	ln, err := net.Listen("tcp", qs.metricsAddr)
+	if err != nil {
+		return nil, fmt.Errorf("metrics listener: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", qs.MetricsHandler())
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go srv.Serve(ln)
+	return srv, nil
+}
+
+func (qs *QueueScanner) metrics() []byte {
+	stats := qs.ctx.Stats()
+	var b bytes.Buffer
+
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	if stats.Total >= 0 {
+		metric("flashscan_targets", "gauge", "Targets in this scan, excluding those resumed from a checkpoint.")
+		fmt.Fprintf(&b, "flashscan_targets %d\n", stats.Total)
+	}
+
+	metric("flashscan_scans_completed_total", "counter", "Targets scanned to a final outcome.")
+	fmt.Fprintf(&b, "flashscan_scans_completed_total %d\n", stats.Completed)
+
+	metric("flashscan_scans_success_total", "counter", "Targets reported as hits.")
+	fmt.Fprintf(&b, "flashscan_scans_success_total %d\n", stats.Success)
+
+	metric("flashscan_scans_failed_total", "counter", "Failed targets by failure class.")
+	for _, class := range FailureClasses {
+		fmt.Fprintf(&b, "flashscan_scans_failed_total{class=%q} %d\n", class.String(), stats.Failures[class])
+	}
+
+	metric("flashscan_retries_total", "counter", "Extra attempts made after retryable failures.")
+	fmt.Fprintf(&b, "flashscan_retries_total %d\n", stats.Retries)
+
+	metric("flashscan_resumed_total", "counter", "Targets skipped because a previous run scanned them.")
+	fmt.Fprintf(&b, "flashscan_resumed_total %d\n", stats.Resumed)
+
+	metric("flashscan_input_dropped_total", "counter", "Input lines not scanned by reason.")
+	for _, reason := range DropReasons {
+		fmt.Fprintf(&b, "flashscan_input_dropped_total{reason=%q} %d\n", reason.String(), stats.Dropped[reason])
+	}
+
+	metric("flashscan_scan_rate", "gauge", "Scans started per second, recently sampled.")
+	fmt.Fprintf(&b, "flashscan_scan_rate %g\n", stats.Rate)
+
+	metric("flashscan_rate_limit", "gauge", "Configured scans per second, 0 if unlimited.")
+	fmt.Fprintf(&b, "flashscan_rate_limit %g\n", stats.RateLimit)
+
+	metric("flashscan_workers", "gauge", "Current worker count.")
+	fmt.Fprintf(&b, "flashscan_workers %d\n", stats.Workers)
+
+	metric("flashscan_queue_depth", "gauge", "Targets waiting in the queue.")
+	fmt.Fprintf(&b, "flashscan_queue_depth %d\n", len(qs.queue))
+
+	metric("flashscan_scan_duration_seconds", "histogram", "Time taken by each scan attempt.")
+	qs.ctx.latencySuccess.write(&b, "flashscan_scan_duration_seconds", `outcome="success"`)
+	qs.ctx.latencyFailure.write(&b, "flashscan_scan_duration_seconds", `outcome="failure"`)
+
+	return b.Bytes()
+}
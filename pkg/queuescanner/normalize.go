@@ -0,0 +1,225 @@
+package queuescanner
+
+import (
+	"hash/fnv"
+	"net"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/net/idna"
+)
+
+// DropReason says why an input line was not scanned.
+type DropReason int
+
+const (
+	DropComment   DropReason = iota // blank or comment line
+	DropInvalid                     // not a hostname, IP address or URL
+	DropDuplicate                   // the host was already queued
+
+	numDropReasons
+)
+
+var dropNames = [numDropReasons]string{
+	"comment",
+	"invalid",
+	"duplicate",
+}
+
+// DropReasons lists every reason in display order.
+var DropReasons = []DropReason{DropDuplicate, DropInvalid, DropComment}
+
+// String returns the machine readable name of the reason.
+func (r DropReason) String() string {
+	if r < 0 || r >= numDropReasons {
+		return "unknown"
+	}
+	return dropNames[r]
+}
+
+// hostProfile maps and punycode-encodes hostnames like a lookup would, but
+// accepts underscores and labels such as "r3---sn-abc" seen in the wild
+var hostProfile = idna.New(
+	idna.MapForLookup(),
+	idna.Transitional(false),
+	idna.StrictDomainName(false),
+	idna.CheckHyphens(false),
+)
+
+// NormalizeOptions configures the input normalisation applied to every target
+// before it is queued.
+type NormalizeOptions struct {
+	// Dedup drops hosts that were already queued.
+	Dedup bool
+	// DedupMemory bounds the memory used by Dedup, in bytes. 0 remembers every
+	// host exactly; otherwise a Bloom filter of this size is used, which may
+	// drop a small share of unique hosts as duplicates once it fills up.
+	DedupMemory int
+	// Rewrite, if set, is applied to each normalised host before
+	// deduplication, e.g. to reduce subdomains to their parent domain.
+	Rewrite func(host string) string
+}
+
+// NormalizeHost reduces an input line to a lowercase ASCII hostname or IP
+// address. URLs and host:port pairs are cut down to the host, trailing dots
+// and "#" comments are removed and IDNs are punycode-encoded. It returns the
+// reason when the line holds no usable host.
+func NormalizeHost(line string) (string, DropReason, bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+		return "", DropComment, false
+	}
+	host := fields[0]
+
+	if strings.Contains(host, "://") {
+		u, err := url.Parse(host)
+		if err != nil {
+			return "", DropInvalid, false
+		}
+		host = u.Hostname()
+	} else {
+		host, _, _ = strings.Cut(host, "#")
+		host, _, _ = strings.Cut(host, "/")
+		if i := strings.LastIndexByte(host, '@'); i >= 0 {
+			host = host[i+1:]
+		}
+		// A single colon separates a port; more than one is a bare IPv6 address,
+		// which may be bracketed without a port
+		if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+			host = host[1 : len(host)-1]
+		} else if strings.HasPrefix(host, "[") || strings.Count(host, ":") == 1 {
+			h, _, err := net.SplitHostPort(host)
+			if err != nil {
+				return "", DropInvalid, false
+			}
+			host = h
+		}
+	}
+
+	host = strings.TrimRight(host, ".")
+	if host == "" {
+		return "", DropInvalid, false
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), 0, true
+	}
+
+	ascii, err := hostProfile.ToASCII(host)
+	if err != nil || !validHostname(ascii) {
+		return "", DropInvalid, false
+	}
+	return ascii, 0, true
+}
+
+// validHostname checks the length and characters of every label. Underscores
+// are allowed as they are common in service records.
+func validHostname(host string) bool {
+	if len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range []byte(label) {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// hostSet remembers the hosts queued so far
+type hostSet interface {
+	// add reports whether host was new.
+	add(host string) bool
+}
+
+// exactSet remembers every host
+type exactSet map[string]struct{}
+
+func (s exactSet) add(host string) bool {
+	if _, ok := s[host]; ok {
+		return false
+	}
+	s[host] = struct{}{}
+	return true
+}
+
+// bloomHashes is the number of bit positions set per host
+const bloomHashes = 7
+
+// bloomSet is a fixed-size Bloom filter: membership tests may give false
+// positives, never false negatives
+type bloomSet struct {
+	bits []uint64
+}
+
+func newBloomSet(bytes int) *bloomSet {
+	return &bloomSet{bits: make([]uint64, max(bytes/8, 1))}
+}
+
+func (s *bloomSet) add(host string) bool {
+	h := fnv.New64a()
+	h.Write([]byte(host))
+	h1 := h.Sum64()
+	h2 := h1>>33 | h1<<31 | 1 // double hashing, odd so every bit is reachable
+
+	n := uint64(len(s.bits)) * 64
+	added := false
+	for i := uint64(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) % n
+		word, mask := bit/64, uint64(1)<<(bit%64)
+		if s.bits[word]&mask == 0 {
+			s.bits[word] |= mask
+			added = true
+		}
+	}
+	return added
+}
+
+// normalizeSource cleans up and deduplicates the targets of the wrapped
+// source, counting the lines it drops in dropped
+type normalizeSource struct {
+	TargetSource
+	opts    NormalizeOptions
+	seen    hostSet
+	dropped *[numDropReasons]int64
+}
+
+func newNormalizeSource(src TargetSource, opts NormalizeOptions, dropped *[numDropReasons]int64) *normalizeSource {
+	s := &normalizeSource{TargetSource: src, opts: opts, dropped: dropped}
+	if opts.Dedup {
+		if opts.DedupMemory > 0 {
+			s.seen = newBloomSet(opts.DedupMemory)
+		} else {
+			s.seen = make(exactSet)
+		}
+	}
+	return s
+}
+
+func (s *normalizeSource) Next() (string, error) {
+	for {
+		line, err := s.TargetSource.Next()
+		if err != nil {
+			return "", err
+		}
+
+		host, reason, ok := NormalizeHost(line)
+		if ok && s.opts.Rewrite != nil {
+			host = s.opts.Rewrite(host)
+		}
+		if ok && s.seen != nil && !s.seen.add(host) {
+			reason, ok = DropDuplicate, false
+		}
+		if !ok {
+			atomic.AddInt64(&s.dropped[reason], 1)
+			continue
+		}
+		return host, nil
+	}
+}
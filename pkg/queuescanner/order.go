@@ -0,0 +1,287 @@
+package queuescanner
+
+import (
+	"io"
+	"math/rand/v2"
+	"net"
+	"strings"
+)
+
+// Target orders accepted by SetOrder
+const (
+	OrderSequential = "sequential"
+	OrderRandom     = "random"
+	OrderInterleave = "interleave"
+)
+
+// Orders lists the supported target orders.
+var Orders = []string{OrderSequential, OrderRandom, OrderInterleave}
+
+// orderWindow is how many targets of a streamed list are buffered to reorder
+// them; CIDR blocks are reordered exactly without buffering
+const orderWindow = 1 << 16
+
+// interleaveBlock is the number of consecutive addresses, a /24 in IPv4,
+// that interleaving spreads apart
+const interleaveBlock = 256
+
+// ValidOrder reports whether order is supported.
+func ValidOrder(order string) bool {
+	for _, o := range Orders {
+		if o == order {
+			return true
+		}
+	}
+	return false
+}
+
+// orderSource reorders the targets of src. CIDR blocks are permuted by
+// index; any other source is reordered within a sliding window.
+func orderSource(src TargetSource, order string, seed uint64) TargetSource {
+	if order == OrderSequential || order == "" {
+		return src
+	}
+
+	switch s := src.(type) {
+	case *cidrSource:
+		if perm := s.ordered(order, seed); perm != nil {
+			return perm
+		}
+	case *compositeSource:
+		for i, child := range s.sources {
+			s.sources[i] = orderSource(child, order, seed+uint64(i))
+		}
+		return s
+	}
+	return newWindowSource(src, order, seed)
+}
+
+// mix64 is the splitmix64 finaliser
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// feistel is a keyed permutation of [0, 2^(2*half))
+type feistel struct {
+	half uint
+	keys [4]uint64
+}
+
+func newFeistel(bits uint, seed uint64) *feistel {
+	f := &feistel{half: (bits + 1) / 2}
+	for i := range f.keys {
+		seed = mix64(seed + 0x9e3779b97f4a7c15)
+		f.keys[i] = seed
+	}
+	return f
+}
+
+func (f *feistel) permute(x uint64) uint64 {
+	mask := uint64(1)<<f.half - 1
+	l, r := x>>f.half, x&mask
+	for _, k := range f.keys {
+		l, r = r, l^(mix64(r^k)&mask)
+	}
+	return l<<f.half | r
+}
+
+// permutedCIDRSource yields the addresses of a network in a computed order,
+// keeping nothing but the position
+type permutedCIDRSource struct {
+	network net.IP
+	size    uint64 // addresses in the network, including network and broadcast
+	single  bool
+	total   int64
+	pos     uint64
+	offset  func(pos uint64) uint64
+}
+
+// ordered returns the block in the given order, or nil when the block is too
+// large to be permuted by index.
+func (s *cidrSource) ordered(order string, seed uint64) TargetSource {
+	ones, bits := s.ipnet.Mask.Size()
+	hostBits := uint(bits - ones)
+	if hostBits >= 63 {
+		return nil
+	}
+
+	p := &permutedCIDRSource{
+		network: s.ipnet.IP,
+		size:    uint64(1) << hostBits,
+		single:  s.single,
+		total:   s.total,
+	}
+
+	switch order {
+	case OrderRandom:
+		f := newFeistel(hostBits, seed)
+		p.offset = func(pos uint64) uint64 {
+			// Cycle-walk until the permuted value falls inside the block
+			x := f.permute(pos)
+			for x >= p.size {
+				x = f.permute(x)
+			}
+			return x
+		}
+	case OrderInterleave:
+		blocks := p.size / interleaveBlock
+		if blocks < 2 {
+			return s
+		}
+		// Take one address from every block before the next from any
+		p.offset = func(pos uint64) uint64 {
+			return pos%blocks*interleaveBlock + pos/blocks
+		}
+	default:
+		return s
+	}
+	return p
+}
+
+func (s *permutedCIDRSource) Next() (string, error) {
+	for s.pos < s.size {
+		offset := s.offset(s.pos)
+		s.pos++
+
+		// Skip the network and broadcast addresses
+		if !s.single && (offset == 0 || offset == s.size-1) {
+			continue
+		}
+		return ipAdd(s.network, offset).String(), nil
+	}
+	return "", io.EOF
+}
+
+func (s *permutedCIDRSource) Total() int64 { return s.total }
+func (s *permutedCIDRSource) Close() error { return nil }
+
+// ipAdd returns ip plus n
+func ipAdd(ip net.IP, n uint64) net.IP {
+	out := append(net.IP(nil), ip...)
+	for j := len(out) - 1; j >= 0 && n > 0; j-- {
+		sum := uint64(out[j]) + n&0xff
+		out[j] = byte(sum)
+		n = n>>8 + sum>>8
+	}
+	return out
+}
+
+// windowSource reorders a streamed source within a window of buffered
+// targets, so memory stays bounded however long the list is
+type windowSource struct {
+	TargetSource
+	order string
+	rng   *rand.Rand
+	eof   bool
+
+	// random
+	buf []string
+
+	// interleave: targets grouped by subnet or parent domain, served round robin
+	groups   map[string]*targetGroup
+	ring     []*targetGroup
+	buffered int
+}
+
+type targetGroup struct {
+	key     string
+	targets []string
+}
+
+func newWindowSource(src TargetSource, order string, seed uint64) *windowSource {
+	return &windowSource{
+		TargetSource: src,
+		order:        order,
+		rng:          rand.New(rand.NewPCG(seed, 0)),
+		groups:       make(map[string]*targetGroup),
+	}
+}
+
+func (s *windowSource) Next() (string, error) {
+	if err := s.fill(); err != nil {
+		return "", err
+	}
+
+	if s.order == OrderRandom {
+		if len(s.buf) == 0 {
+			return "", io.EOF
+		}
+		i := s.rng.IntN(len(s.buf))
+		target := s.buf[i]
+		s.buf[i] = s.buf[len(s.buf)-1]
+		s.buf = s.buf[:len(s.buf)-1]
+		return target, nil
+	}
+
+	if len(s.ring) == 0 {
+		return "", io.EOF
+	}
+	g := s.ring[0]
+	s.ring = s.ring[1:]
+	target := g.targets[0]
+	g.targets = g.targets[1:]
+	s.buffered--
+	if len(g.targets) > 0 {
+		s.ring = append(s.ring, g)
+	} else {
+		delete(s.groups, g.key)
+	}
+	return target, nil
+}
+
+// fill reads ahead until the window is full or the source is exhausted
+func (s *windowSource) fill() error {
+	for !s.eof && len(s.buf)+s.buffered < orderWindow {
+		target, err := s.TargetSource.Next()
+		if err == io.EOF {
+			s.eof = true
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if s.order == OrderRandom {
+			s.buf = append(s.buf, target)
+			continue
+		}
+
+		key := orderGroup(target)
+		g, ok := s.groups[key]
+		if !ok {
+			g = &targetGroup{key: key}
+			s.groups[key] = g
+			s.ring = append(s.ring, g)
+		}
+		g.targets = append(g.targets, target)
+		s.buffered++
+	}
+	return nil
+}
+
+// orderGroup returns what interleaving spreads targets across: the /24 of
+// an IPv4 address, the /64 of an IPv6 address or the parent domain of a host
+func orderGroup(line string) string {
+	host, _, ok := NormalizeHost(line)
+	if !ok {
+		return line
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if v4 := ip.To4(); v4 != nil {
+			return v4.Mask(net.CIDRMask(24, 32)).String()
+		}
+		return ip.Mask(net.CIDRMask(64, 128)).String()
+	}
+
+	labels := strings.Split(host, ".")
+	if len(labels) > 2 {
+		labels = labels[len(labels)-2:]
+	}
+	return strings.Join(labels, ".")
+}
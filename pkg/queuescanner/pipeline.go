@@ -0,0 +1,309 @@
+package queuescanner
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Pipe is a TargetSource fed by another scan: Next blocks until a target is
+// sent or the pipe is closed.
+type Pipe struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	targets []string
+	seen    map[string]struct{} // every target sent, as a scan may hit one several times
+	sent    int64
+	closed  bool
+}
+
+// NewPipe returns an empty, open pipe.
+func NewPipe() *Pipe {
+	p := &Pipe{seen: make(map[string]struct{})}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// Send queues a target. Targets already sent, e.g. a host that was a hit on
+// several ports, and targets sent after CloseSend are dropped.
+func (p *Pipe) Send(target string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	if _, ok := p.seen[target]; ok {
+		return
+	}
+	p.seen[target] = struct{}{}
+	p.targets = append(p.targets, target)
+	p.sent++
+	p.cond.Signal()
+}
+
+// CloseSend marks the end of the targets; Next returns io.EOF once the
+// queued ones are read.
+func (p *Pipe) CloseSend() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	p.cond.Broadcast()
+}
+
+func (p *Pipe) Next() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.targets) == 0 {
+		if p.closed {
+			return "", io.EOF
+		}
+		p.cond.Wait()
+	}
+	target := p.targets[0]
+	p.targets[0] = ""
+	p.targets = p.targets[1:]
+	return target, nil
+}
+
+// Total is the number of targets sent once the pipe is closed, -1 before.
+func (p *Pipe) Total() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.closed {
+		return -1
+	}
+	return p.sent
+}
+
+func (p *Pipe) Close() error {
+	p.CloseSend()
+	return nil
+}
+
+// StageStats is the progress of one stage of a pipeline.
+type StageStats struct {
+	Name    string
+	Started bool
+	Done    bool
+	Stats
+}
+
+// pipelineStage is a scanner in a pipeline together with its input
+type pipelineStage struct {
+	name  string
+	qs    *QueueScanner
+	input *Pipe // nil for the first stage
+}
+
+// Pipeline chains scanners: the targets a stage reports as hits are fed
+// into the next stage. Stages run one after the other, or all at once with
+// targets streamed between them as they are found.
+type Pipeline struct {
+	renderer  Renderer
+	streaming bool
+	stages    []*pipelineStage
+
+	mu        sync.Mutex
+	stats     []StageStats
+	startTime int64
+	finished  int32
+}
+
+// NewPipeline returns an empty pipeline shown by renderer. With streaming,
+// every stage starts right away and scans hits of the previous stage as
+// they come in.
+func NewPipeline(renderer Renderer, streaming bool) *Pipeline {
+	return &Pipeline{renderer: renderer, streaming: streaming}
+}
+
+// AddStage appends a scanner to the pipeline. Every stage but the first
+// must have been given input as its target source, and receives the hits of
+// the stage before. The scanner's renderer is replaced by the pipeline's.
+func (p *Pipeline) AddStage(name string, qs *QueueScanner, input *Pipe) {
+	if n := len(p.stages); n > 0 && input != nil {
+		p.stages[n-1].qs.ctx.onHit = func(res *Result) {
+			input.Send(res.Target)
+		}
+	}
+
+	i := len(p.stages)
+	qs.SetRenderer(&stageRenderer{pipeline: p, index: i})
+	p.stages = append(p.stages, &pipelineStage{name: name, qs: qs, input: input})
+	p.stats = append(p.stats, StageStats{Name: name, Stats: Stats{Total: -1, ETA: -1}})
+}
+
+// Start runs the pipeline until every stage is done or SIGINT/SIGTERM is
+// received.
+func (p *Pipeline) Start() Summary {
+	return withSignals(p.Run)
+}
+
+// Run runs the stages and renders their combined progress. A stage that is
+// interrupted or fails ends the pipeline. The summary counts the hits of
+// the last stage as successes.
+func (p *Pipeline) Run(ctx context.Context) Summary {
+	if len(p.stages) == 0 {
+		return Summary{}
+	}
+
+	p.startTime = nowNano()
+	last := p.stages[len(p.stages)-1]
+	p.renderer.Start(last.qs.ctx.columns)
+
+	summaries := make([]Summary, len(p.stages))
+	if p.streaming {
+		var wg sync.WaitGroup
+		for i := range p.stages {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				summaries[i] = p.runStage(ctx, i)
+			}()
+		}
+		wg.Wait()
+	} else {
+		for i := range p.stages {
+			summaries[i] = p.runStage(ctx, i)
+			if summaries[i].Interrupted || summaries[i].Err != nil {
+				// Unblock and skip the stages after it
+				for _, s := range p.stages[i+1:] {
+					s.input.CloseSend()
+				}
+				break
+			}
+		}
+	}
+
+	atomic.StoreInt32(&p.finished, 1)
+	summary := Summary{
+		Elapsed: time.Duration(nowNano() - p.startTime),
+	}
+	for i, s := range summaries {
+		summary.Total += max(s.Total, 0)
+		summary.Completed += s.Completed
+		if i == len(summaries)-1 {
+			summary.Success = s.Success
+		}
+		if s.Interrupted || !p.stats[i].Done {
+			summary.Interrupted = true
+		}
+		if s.Err != nil && summary.Err == nil {
+			summary.Err = s.Err
+		}
+	}
+
+	stats := p.combined()
+	stats.Interrupted = summary.Interrupted
+	p.renderer.Summary(stats)
+	return summary
+}
+
+// runStage runs stage i and then closes the input of the next one
+func (p *Pipeline) runStage(ctx context.Context, i int) Summary {
+	stage := p.stages[i]
+	if i+1 < len(p.stages) {
+		defer p.stages[i+1].input.CloseSend()
+	}
+
+	// A stage started after the previous one finished knows its total
+	if stage.input != nil {
+		atomic.StoreInt64(&stage.qs.ctx.total, stage.input.Total())
+	}
+
+	p.mu.Lock()
+	p.stats[i].Started = true
+	p.mu.Unlock()
+
+	summary := stage.qs.Run(ctx)
+
+	p.mu.Lock()
+	p.stats[i].Done = !summary.Interrupted && summary.Err == nil
+	p.mu.Unlock()
+	return summary
+}
+
+// update records the stats of stage i and redraws
+func (p *Pipeline) update(i int, stats Stats) {
+	p.mu.Lock()
+	p.stats[i].Stats = stats
+	p.mu.Unlock()
+
+	if atomic.LoadInt32(&p.finished) == 0 {
+		p.renderer.Progress(p.combined())
+	}
+}
+
+// combined sums up the stages: the work done by all of them, and the hits
+// of the last
+func (p *Pipeline) combined() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := Stats{
+		Elapsed: time.Duration(nowNano() - p.startTime),
+		ETA:     -1,
+		Stages:  append([]StageStats(nil), p.stats...),
+	}
+	for _, stage := range p.stats {
+		if stage.Total < 0 || s.Total < 0 {
+			s.Total = -1
+		} else {
+			s.Total += stage.Total
+		}
+		s.Completed += stage.Completed
+		s.Failed += stage.Failed
+		s.Retries += stage.Retries
+		s.Resumed += stage.Resumed
+		s.Paused = s.Paused || stage.Paused
+		for class := range s.Failures {
+			s.Failures[class] += stage.Failures[class]
+		}
+		for reason := range s.Dropped {
+			s.Dropped[reason] += stage.Dropped[reason]
+		}
+		if !stage.Started || stage.Done {
+			continue
+		}
+		s.Rate += stage.Rate
+		s.RateLimit += stage.RateLimit
+		s.Workers += stage.Workers
+	}
+
+	last := p.stats[len(p.stats)-1]
+	s.Success = last.Success
+	s.Latency = last.Latency
+	s.OutputFile = last.OutputFile
+	s.FailuresFile = last.FailuresFile
+	if s.Total > 0 {
+		s.Percent = min(float64(s.Completed)/float64(s.Total)*100, 100)
+	}
+	if s.Elapsed > 0 {
+		s.Speed = float64(s.Completed) / s.Elapsed.Seconds()
+	}
+	return s
+}
+
+// stageRenderer passes the progress of a stage on to its pipeline. Only the
+// results of the last stage are shown.
+type stageRenderer struct {
+	pipeline *Pipeline
+	index    int
+}
+
+func (r *stageRenderer) Start(columns []Column) {}
+
+func (r *stageRenderer) Result(res *Result, hit bool) {
+	if r.index == len(r.pipeline.stages)-1 {
+		r.pipeline.renderer.Result(res, hit)
+	}
+}
+
+func (r *stageRenderer) Progress(stats Stats) {
+	r.pipeline.update(r.index, stats)
+}
+
+func (r *stageRenderer) Summary(stats Stats) {
+	r.pipeline.update(r.index, stats)
+}
@@ -0,0 +1,143 @@
+package queuescanner
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// autoThreadsWindow is how often the adaptive controller re-evaluates
+	autoThreadsWindow = 2 * time.Second
+	// autoThreadsMinSamples is the number of completions a window needs
+	// before its timeout ratio is trusted
+	autoThreadsMinSamples = 20
+	// autoThreadsTolerance is how far the congestion ratio may rise above
+	// its running average before the controller backs off
+	autoThreadsTolerance = 0.10
+	// autoThreadsBackoff is the multiplicative decrease factor
+	autoThreadsBackoff = 0.75
+)
+
+// setWorkers changes the number of active workers, starting new ones right
+// away. Surplus workers exit after finishing their current scan.
+func (qs *QueueScanner) setWorkers(n int) {
+	if n < 1 {
+		n = 1
+	}
+
+	qs.poolMu.Lock()
+	defer qs.poolMu.Unlock()
+
+	qs.workerLimit = n
+	atomic.StoreInt64(&qs.ctx.workers, int64(n))
+
+	// Once the queue is closed the WaitGroup may already be draining
+	if qs.draining {
+		return
+	}
+	for qs.running < qs.workerLimit {
+		qs.running++
+		qs.wg.Add(1)
+		go qs.run()
+	}
+}
+
+// workerCount returns the current worker limit.
+func (qs *QueueScanner) workerCount() int {
+	qs.poolMu.Lock()
+	defer qs.poolMu.Unlock()
+	return qs.workerLimit
+}
+
+// retireWorker reports whether the calling worker is surplus and must exit.
+func (qs *QueueScanner) retireWorker() bool {
+	qs.poolMu.Lock()
+	defer qs.poolMu.Unlock()
+
+	if qs.running > qs.workerLimit {
+		qs.running--
+		return true
+	}
+	return false
+}
+
+// workerDone is called by a worker leaving because the queue is closed.
+func (qs *QueueScanner) workerDone() {
+	qs.poolMu.Lock()
+	defer qs.poolMu.Unlock()
+
+	qs.draining = true
+	qs.running--
+}
+
+// adjustThreads tunes the worker count AIMD-style: it adds workers while the
+// share of timeouts and connection errors stays flat, and cuts them back
+// multiplicatively as soon as that share rises.
+func (qs *QueueScanner) adjustThreads(stop <-chan struct{}) {
+	ticker := time.NewTicker(autoThreadsWindow)
+	defer ticker.Stop()
+
+	var lastComplete, lastCongested int64
+	average := -1.0
+	step := qs.maxThreads / 32
+	if step < 1 {
+		step = 1
+	}
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		complete := atomic.LoadInt64(&qs.ctx.ScanComplete)
+		congested := atomic.LoadInt64(&qs.ctx.congested)
+		samples := complete - lastComplete
+		if samples < autoThreadsMinSamples {
+			continue
+		}
+
+		ratio := float64(congested-lastCongested) / float64(samples)
+		lastComplete, lastCongested = complete, congested
+
+		workers := qs.workerCount()
+		if average >= 0 && ratio > average+autoThreadsTolerance {
+			workers = int(float64(workers) * autoThreadsBackoff)
+		} else {
+			workers += step
+		}
+
+		if workers < qs.minThreads {
+			workers = qs.minThreads
+		}
+		if workers > qs.maxThreads {
+			workers = qs.maxThreads
+		}
+		qs.setWorkers(workers)
+
+		if average < 0 {
+			average = ratio
+		} else {
+			average = 0.7*average + 0.3*ratio
+		}
+	}
+}
+
+// isCongestionError reports whether err suggests the link or the local host
+// is overloaded rather than the target giving a definitive answer.
+func isCongestionError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return isCongestionErrno(err)
+}
@@ -1,7 +1,11 @@
 package queuescanner
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
@@ -9,8 +13,6 @@ import (
 	"sync/atomic"
 	"syscall"
 	"time"
-
-	"golang.org/x/term"
 )
 
 // ANSI Color codes
@@ -26,137 +28,236 @@ const (
 	ColorBold    = "\033[1m"
 )
 
+// Ctx is handed to the scan function. A scan gets its own Ctx, tied to the
+// queued target, sharing the state of the whole run.
 type Ctx struct {
+	*runState
+	item   *queueItem // the target being scanned, nil outside a scan
+	timing *Timing    // phases of the scan, see SetTiming
+}
+
+// runState is the state of a run shared by every scan
+type runState struct {
 	ScanComplete int64
 	SuccessCount int64
 	startTime    int64
 	lastStatTime int64
 	statInterval int64 // in nanoseconds
+	finished     int32 // set once the summary is printed; stragglers stop redrawing
 
-	hostList     []string
-	mu           sync.Mutex
+	source       TargetSource
+	total        int64 // known or estimated target count, -1 if unknown
+	resumed      int64 // targets skipped because a previous run scanned them
+	baseCtx      context.Context
+	mu           sync.Mutex // guards writer and failureWriter
 	OutputFile   string
-	lastResults  []string // Buffer for last N results
-	resultsMutex sync.Mutex
-	maxResults   int // Dynamic based on screen height
+	outputFormat string
+	writer       ResultWriter
+	columns      []Column
+	renderer     Renderer
+	onHit        func(res *Result) // passes hits on to the next pipeline stage
+
+	FailuresFile  string
+	failureWriter ResultWriter
+	failures      [numFailureClasses]int64 // failed targets by FailureClass
+	dropped       [numDropReasons]int64    // input lines skipped by DropReason
+
+	latencySuccess histogram // duration of scan attempts, for metrics
+	latencyFailure histogram
+	phases         [numPhases]latencyDist // durations by Phase, for percentiles
+
+	started     int64 // scans dispatched so far, sampled for the live rate
+	congested   int64 // scans that failed with a timeout or connection error
+	retried     int64 // scans repeated after a retryable failure
+	workers     int64 // current worker limit, for display
+	limiter     *rateLimiter
+	pause       pauseGate
+	rateMu      sync.Mutex
+	rateSampleN int64
+	rateSampleT int64
+	currentRate float64
 }
 
-type QueueScanner struct {
-	threads  int
-	scanFunc func(c *Ctx, host string)
-	queue    chan string
-	wg       sync.WaitGroup
-	ctx      *Ctx
-}
+// ScanFunc probes a single target. It returns nil when the target answered,
+// whether or not it was a hit, and the failure otherwise.
+type ScanFunc func(c *Ctx, host string) error
 
-func nowNano() int64 {
-	return time.Now().UnixNano()
+// logEntry is a result shown in the dashboard
+type logEntry struct {
+	result *Result
+	hit    bool
 }
 
-func formatETA(seconds float64) string {
-	if seconds < 0 {
-		return "--"
-	}
-	d := time.Duration(seconds * float64(time.Second))
-	return d.Truncate(time.Second).String()
+type QueueScanner struct {
+	threads     int
+	scanFunc    ScanFunc
+	queue       chan queueItem
+	wg          sync.WaitGroup
+	ctx         *Ctx
+	gracePeriod time.Duration
+	limiter     *rateLimiter
+
+	poolMu      sync.Mutex
+	running     int  // workers currently alive
+	workerLimit int  // workers wanted
+	draining    bool // the queue is closed, no new workers may start
+	autoThreads bool
+	minThreads  int
+	maxThreads  int
+
+	normalize *NormalizeOptions
+	order     string
+	seed      uint64
+
+	productInner func() TargetSource // set to pair every target, see SetProduct
+	productJoin  func(target, item string) string
+
+	shardIndex int // from 1, 0 when not sharded
+	shardCount int
+
+	remote *CoordinatorClient // set for a worker of a coordinator
+
+	metricsAddr string
+	controlAddr string
+	stop        context.CancelFunc // cancels the context of Run
+
+	retries      int
+	retryBackoff time.Duration
+	outstanding  sync.WaitGroup // queued, in-flight or waiting to be retried
+
+	checkpointPath string
+	checkpoint     *Checkpoint
+	checkpointMu   sync.Mutex
+	progress       *progressTracker
 }
 
-func formatDuration(seconds float64) string {
-	d := time.Duration(seconds * float64(time.Second))
-	return d.Truncate(time.Second).String()
+// queueItem is a target together with its position in the source
+type queueItem struct {
+	index   int64
+	target  string
+	attempt int // retries made so far
 }
 
-func hideCursor() {
-	fmt.Print("\033[?25l")
+// Summary is returned by Run once the queue is drained or the scan is cancelled.
+type Summary struct {
+	Total       int64
+	Completed   int64
+	Success     int64
+	Elapsed     time.Duration
+	Interrupted bool  // the context was cancelled before every target was scanned
+	Err         error // error reading the target source or saving the checkpoint
 }
 
-func showCursor() {
-	fmt.Print("\033[?25h")
-}
+// DefaultGracePeriod is how long Run waits for in-flight scans after cancellation.
+const DefaultGracePeriod = 5 * time.Second
 
-func printBanner() {
-	banner := `  ______ _           _      _____                 
- |  ____| |         | |    / ____|                
- | |__  | | __ _ ___| |__ | (___   ___ __ _ _ __  
- |  __| | |/ _` + "`" + ` / __| '_ \ \___ \ / __/ _` + "`" + ` | '_ \ 
- | |    | | (_| \__ \ | | |____) | (_| (_| | | | |
- |_|    |_|\__,_|___/_| |_|_____/ \___\__,_|_| |_| v2.0`
-	fmt.Printf("%s%s%s\n", ColorCyan+ColorBold, banner, ColorReset)
+func nowNano() int64 {
+	return time.Now().UnixNano()
 }
 
-// Calculate dynamic max results based on terminal height
-func getMaxResults() int {
-	_, height, err := term.GetSize(int(os.Stdout.Fd()))
-	if err != nil {
-		return 10 // Default fallback
+// Context returns the context of the running scan. Scan functions should pass it
+// to every dial, lookup and handshake so they abort when the scan is cancelled.
+func (ctx *Ctx) Context() context.Context {
+	if ctx.baseCtx == nil {
+		return context.Background()
 	}
+	return ctx.baseCtx
+}
+
+// Log shows a result in the dashboard without counting it as a hit.
+func (ctx *Ctx) Log(res *Result) {
+	ctx.renderer.Result(res, false)
+}
 
-	// Banner: 4 lines
-	// Progress box: 5 lines
-	// Header: 2 lines
-	// Table header: 3 lines
-	// Footer: 2 lines
-	// Total overhead: ~16 lines
+// sampleRate returns the number of scans started per second since the
+// previous sample
+func (ctx *Ctx) sampleRate() float64 {
+	ctx.rateMu.Lock()
+	defer ctx.rateMu.Unlock()
 
-	available := height - 16
-	if available < 5 {
-		return 5 // Minimum
+	now := nowNano()
+	started := atomic.LoadInt64(&ctx.started)
+	if ctx.rateSampleT == 0 {
+		ctx.rateSampleT = ctx.startTime
 	}
-	if available > 50 {
-		return 50 // Maximum
+	if window := now - ctx.rateSampleT; window >= int64(100*time.Millisecond) {
+		ctx.currentRate = float64(started-ctx.rateSampleN) / (float64(window) / 1e9)
+		ctx.rateSampleN = started
+		ctx.rateSampleT = now
 	}
-	return available
+	return ctx.currentRate
 }
 
-// Add result to buffer
-func (ctx *Ctx) Log(a ...any) {
-	msg := fmt.Sprint(a...)
-
-	ctx.resultsMutex.Lock()
-	ctx.lastResults = append(ctx.lastResults, msg)
-	// Keep only last N results
-	if len(ctx.lastResults) > ctx.maxResults {
-		ctx.lastResults = ctx.lastResults[1:]
-	}
-	ctx.resultsMutex.Unlock()
+// Stats is a snapshot of a running scan, as handed to the Renderer.
+type Stats struct {
+	Total        int64 // -1 if unknown
+	Completed    int64
+	Success      int64
+	Failed       int64
+	Resumed      int64 // targets skipped because a previous run scanned them
+	Percent      float64
+	Elapsed      time.Duration
+	Speed        float64       // completed targets per second since the start
+	ETA          time.Duration // -1 if unknown
+	Rate         float64       // scans started per second, sampled recently
+	RateLimit    float64       // 0 if unlimited
+	Workers      int64
+	Paused       bool
+	Retries      int64                    // extra attempts, not counted in Completed
+	Failures     [numFailureClasses]int64 // failed targets by FailureClass
+	Dropped      [numDropReasons]int64    // input lines not scanned by DropReason
+	Latency      [numPhases]Percentiles   // durations by Phase; Total counts hits only
+	Stages       []StageStats             // per stage, when scanning a Pipeline
+	OutputFile   string
+	FailuresFile string
+	Interrupted  bool
 }
 
-// Helper to calculate visual width of a string (accounting for ANSI and wide chars)
-func visualWidth(s string) int {
-	w := 0
-	inEscape := false
-	for _, r := range s {
-		if r == '\033' {
-			inEscape = true
-			continue
-		}
-		if inEscape {
-			if r == 'm' {
-				inEscape = false
-			}
-			continue
-		}
-		// Estimating cell width: Emojis and some special chars are usually 2 cells
-		if r > 0x1F000 || r == 0x26A1 || r == 0x2714 || r == 0x2716 || r == 0x23F1 {
-			w += 2
-		} else {
-			w += 1
-		}
+// Stats returns a snapshot of the scan progress.
+func (ctx *Ctx) Stats() Stats {
+	s := Stats{
+		Total:        atomic.LoadInt64(&ctx.total),
+		Completed:    atomic.LoadInt64(&ctx.ScanComplete),
+		Success:      atomic.LoadInt64(&ctx.SuccessCount),
+		Resumed:      atomic.LoadInt64(&ctx.resumed),
+		Elapsed:      time.Duration(nowNano() - ctx.startTime),
+		ETA:          -1,
+		Rate:         ctx.sampleRate(),
+		RateLimit:    ctx.limiter.limit(),
+		Workers:      atomic.LoadInt64(&ctx.workers),
+		Paused:       ctx.pause.paused(),
+		Retries:      atomic.LoadInt64(&ctx.retried),
+		OutputFile:   ctx.OutputFile,
+		FailuresFile: ctx.FailuresFile,
+	}
+	s.Failed = s.Completed - s.Success
+	for class := range s.Failures {
+		s.Failures[class] = atomic.LoadInt64(&ctx.failures[class])
+	}
+	for reason := range s.Dropped {
+		s.Dropped[reason] = atomic.LoadInt64(&ctx.dropped[reason])
+	}
+	for phase := range s.Latency {
+		s.Latency[phase] = ctx.phases[phase].percentiles()
 	}
-	return w
-}
 
-func (ctx *Ctx) printBoxLine(content string) {
-	w := visualWidth(content)
-	padding := 67 - w
-	if padding < 0 {
-		padding = 0
+	if s.Total > 0 {
+		s.Percent = min(float64(s.Completed)/float64(s.Total)*100, 100)
+	}
+	if s.Elapsed > 0 {
+		s.Speed = float64(s.Completed) / s.Elapsed.Seconds()
 	}
-	fmt.Printf("%s%s%s┃%s\n", ColorBlue, content, strings.Repeat(" ", padding), ColorReset)
+	if s.Speed > 0 && s.Total > 0 {
+		s.ETA = time.Duration(float64(s.Total-s.Completed) / s.Speed * float64(time.Second))
+	}
+	return s
 }
 
-// Redraw entire screen with progress and results
+// LogStat hands fresh stats to the renderer, at most once per stat interval.
 func (ctx *Ctx) LogStat() {
+	if atomic.LoadInt32(&ctx.finished) != 0 {
+		return
+	}
 	if ctx.statInterval > 0 {
 		now := nowNano()
 		if now-atomic.LoadInt64(&ctx.lastStatTime) < ctx.statInterval {
@@ -165,228 +266,625 @@ func (ctx *Ctx) LogStat() {
 		atomic.StoreInt64(&ctx.lastStatTime, now)
 	}
 
-	scanSuccess := atomic.LoadInt64(&ctx.SuccessCount)
-	scanComplete := atomic.LoadInt64(&ctx.ScanComplete)
-	total := len(ctx.hostList)
-	if total == 0 {
+	ctx.renderer.Progress(ctx.Stats())
+}
+
+// forceStat redraws right away, e.g. after the scan was retuned
+func (ctx *Ctx) forceStat() {
+	if ctx.startTime == 0 {
 		return
 	}
-	failed := scanComplete - scanSuccess
-	percentage := float64(scanComplete) / float64(total) * 100
-
-	// Calculate stats
-	elapsed := float64(nowNano()-ctx.startTime) / 1e9 // seconds
-	var speed float64
-	if elapsed > 0 {
-		speed = float64(scanComplete) / elapsed
-	}
-
-	var etaSec float64
-	if speed > 0 {
-		remaining := float64(total - int(scanComplete))
-		etaSec = remaining / speed
-	}
-	eta := formatETA(etaSec)
-
-	// Progress bar - FIXED: prevent negative repeat counts
-	barWidth := 40
-	filled := int(percentage / 100 * float64(barWidth))
-	if filled < 0 {
-		filled = 0
-	}
-	if filled > barWidth {
-		filled = barWidth
-	}
-	remaining := barWidth - filled
-	if remaining < 0 {
-		remaining = 0
-	}
-	bar := ColorGreen + strings.Repeat("━", filled) + ColorWhite + strings.Repeat("─", remaining) + ColorReset
-
-	// Clear screen and redraw
-	fmt.Print("\033[2J\033[H")
-
-	// Banner
-	printBanner()
-	fmt.Println()
-
-	// Progress box
-	fmt.Printf("%s┏━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━┓%s\n", ColorBlue, ColorReset)
-	
-	// Progress bar line
-	progressLine := fmt.Sprintf("┃ %s⚡ SCANNING... %s[%s] %s%.1f%%%s",
-		ColorWhite+ColorBold, ColorReset, bar, ColorMagenta, percentage, ColorReset)
-	ctx.printBoxLine(progressLine)
-
-	fmt.Printf("%s┠──────────────────────────────────────────────────────────────────┨%s\n", ColorBlue, ColorReset)
-
-	// Stats line 1
-	statsLine1 := fmt.Sprintf("┃ %s✔ Success: %s%-5d %s┃ %s✖ Failed: %s%-5d %s┃ %s🚀 Speed: %s%-6.0f ",
-		ColorGreen, ColorWhite, scanSuccess, ColorBlue,
-		ColorRed, ColorWhite, failed, ColorBlue,
-		ColorMagenta, ColorWhite, speed)
-	ctx.printBoxLine(statsLine1)
-
-	// Stats line 2
-	statsLine2 := fmt.Sprintf("┃ %s⏱  ETA: %s%-12s %s┃ %s📂 Scanned: %s%d/%d %s┃",
-		ColorYellow, ColorWhite, eta, ColorBlue,
-		ColorCyan, ColorWhite, scanComplete, total, ColorBlue)
-	ctx.printBoxLine(statsLine2)
-
-	fmt.Printf("%s┗━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━┛%s\n", ColorBlue, ColorReset)
-	fmt.Println()
-
-	// Results table
-	fmt.Printf("%s✅ LATEST %d RESULTS:%s\n", ColorGreen+ColorBold, ctx.maxResults, ColorReset)
-
-	ctx.resultsMutex.Lock()
-	resultsCount := len(ctx.lastResults)
-	if resultsCount > 0 {
-		for _, result := range ctx.lastResults {
-			// Color code based on content
-			if strings.Contains(result, "200") || strings.Contains(result, "✓") {
-				fmt.Printf("%s%s%s\n", ColorGreen, result, ColorReset)
-			} else if strings.Contains(result, "timeout") || strings.Contains(result, "failed") || strings.Contains(result, "✗") {
-				fmt.Printf("%s%s%s\n", ColorRed, result, ColorReset)
-			} else if strings.Contains(result, "301") || strings.Contains(result, "302") {
-				fmt.Printf("%s%s%s\n", ColorYellow, result, ColorReset)
-			} else {
-				fmt.Printf("%s\n", result)
-			}
+	atomic.StoreInt64(&ctx.lastStatTime, 0)
+	ctx.LogStat()
+}
+
+// PrintSummary renders the final statistics.
+func (ctx *Ctx) PrintSummary(interrupted bool) {
+	stats := ctx.Stats()
+	stats.Interrupted = interrupted
+	ctx.renderer.Summary(stats)
+}
+
+func (ctx *Ctx) flushWriter() error {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+
+	if ctx.failureWriter != nil {
+		if err := ctx.failureWriter.Flush(); err != nil {
+			return err
 		}
-	} else {
-		fmt.Printf("%sWaiting for results...%s\n", ColorCyan, ColorReset)
 	}
-	ctx.resultsMutex.Unlock()
+	if ctx.writer == nil {
+		return nil
+	}
+	return ctx.writer.Flush()
+}
+
+// closeWriter flushes and closes the output; late hits from workers still
+// running past the grace period are dropped
+func (ctx *Ctx) closeWriter() error {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
 
-	// Footer info
-	if ctx.OutputFile != "" {
-		fmt.Printf("\n%s💾 Results saved to:%s %s%s%s\n",
-			ColorGreen, ColorReset, ColorCyan, ctx.OutputFile, ColorReset)
+	var err error
+	if ctx.failureWriter != nil {
+		err = ctx.failureWriter.Close()
+		ctx.failureWriter = nil
+	}
+	if ctx.writer != nil {
+		if werr := ctx.writer.Close(); err == nil {
+			err = werr
+		}
+		ctx.writer = nil
 	}
+	return err
 }
 
-// Print final summary
-func (ctx *Ctx) PrintSummary() {
-	total := len(ctx.hostList)
-	if total == 0 {
-		return
+// ScanSuccess records a hit: it is counted, written to the output file and
+// shown in the dashboard.
+func (ctx *Ctx) ScanSuccess(res *Result) {
+	ctx.mu.Lock()
+	if ctx.writer != nil {
+		ctx.write(ctx.writer, res)
 	}
-	success := atomic.LoadInt64(&ctx.SuccessCount)
-	failed := int64(total) - success
-	elapsed := float64(nowNano()-ctx.startTime) / 1e9
+	ctx.mu.Unlock()
 
-	fmt.Print("\033[2J\033[H")
+	atomic.AddInt64(&ctx.SuccessCount, 1)
+	ctx.observeTiming(res)
+	ctx.renderer.Result(res, true)
+	if ctx.onHit != nil {
+		ctx.onHit(res)
+	}
+}
 
-	fmt.Printf("\n%s╔══════════════════════════════════════════════════════════════════╗%s\n", ColorGreen+ColorBold, ColorReset)
-	fmt.Printf("%s║                    📊 SCAN COMPLETED                             ║%s\n", ColorGreen+ColorBold, ColorReset)
-	fmt.Printf("%s╚══════════════════════════════════════════════════════════════════╝%s\n\n", ColorGreen+ColorBold, ColorReset)
+// recordFailure counts a failed target by class and writes it to the
+// failures file
+func (ctx *Ctx) recordFailure(target string, err error) {
+	class := ClassifyError(err)
+	res := &Result{Target: target, ErrorClass: class.String()}
+	res.SetField("error", err.Error())
+	var failure *Failure
+	if errors.As(err, &failure) {
+		res.TLS = failure.TLS
+	}
+	if ctx.timing != nil && *ctx.timing != (Timing{}) {
+		timing := *ctx.timing
+		res.Timing = &timing
+	}
+	ctx.addFailure(class, res)
+}
 
-	fmt.Printf("%s📈 Statistics:%s\n", ColorBlue+ColorBold, ColorReset)
-	fmt.Printf("   • Total Scanned: %s%d%s hosts\n", ColorMagenta, total, ColorReset)
-	fmt.Printf("   • %sSuccessful:%s %s%d%s (%.1f%%)\n",
-		ColorGreen, ColorReset, ColorGreen, success, ColorReset,
-		float64(success)/float64(total)*100)
-	fmt.Printf("   • %sFailed:%s %s%d%s (%.1f%%)\n",
-		ColorRed, ColorReset, ColorRed, failed, ColorReset,
-		float64(failed)/float64(total)*100)
-	fmt.Printf("   • Time Elapsed: %s%s%s\n", ColorMagenta, formatDuration(elapsed), ColorReset)
+// addFailure counts a failed target and writes it to the failures file
+func (ctx *Ctx) addFailure(class FailureClass, res *Result) {
+	atomic.AddInt64(&ctx.failures[class], 1)
+	ctx.observePhases(res.Timing)
 
-	if elapsed > 0 {
-		fmt.Printf("   • Average Speed: %s%.1f hosts/sec%s\n",
-			ColorMagenta, float64(total)/elapsed, ColorReset)
+	ctx.mu.Lock()
+	if ctx.failureWriter != nil {
+		ctx.write(ctx.failureWriter, res)
 	}
+	ctx.mu.Unlock()
+
+	ctx.renderer.Result(res, false)
+}
 
-	if ctx.OutputFile != "" {
-		fmt.Printf("\n%s💾 Results saved to:%s %s%s%s\n",
-			ColorGreen, ColorReset, ColorCyan, ctx.OutputFile, ColorReset)
+// itemWriter is a ResultWriter that files results under the queued target
+// they belong to, which their Target may not match
+type itemWriter interface {
+	writeItem(index int64, res *Result) error
+}
+
+// write hands res to w, with the queued target of the scan if w needs it;
+// ctx.mu is held
+func (ctx *Ctx) write(w ResultWriter, res *Result) {
+	if iw, ok := w.(itemWriter); ok && ctx.item != nil {
+		iw.writeItem(ctx.item.index, res)
+		return
 	}
+	w.Write(res)
+}
 
-	fmt.Printf("\n%s✨ Thank you for using FlashScan-Go! ✨%s\n\n",
-		ColorGreen+ColorBold, ColorReset)
+func New(threads int, scanFunc ScanFunc) *QueueScanner {
+	limiter := newRateLimiter(0, 0)
+	return &QueueScanner{
+		threads:     threads,
+		scanFunc:    scanFunc,
+		queue:       make(chan queueItem, threads*10), // Increased buffer
+		gracePeriod: DefaultGracePeriod,
+		limiter:     limiter,
+		ctx: &Ctx{runState: &runState{
+			columns:  DefaultColumns,
+			limiter:  limiter,
+			renderer: defaultRenderer(),
+		}},
+	}
 }
 
-func (ctx *Ctx) ScanSuccess(result any) {
-	if str, ok := result.(string); ok && ctx.OutputFile != "" {
-		ctx.mu.Lock()
-		file, err := os.OpenFile(ctx.OutputFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err == nil {
-			file.WriteString(str + "\n")
-			file.Close()
-		}
-		ctx.mu.Unlock()
+// SetOptions sets the target source, output file and stat interval. The
+// source is consumed lazily and closed when Run returns.
+func (qs *QueueScanner) SetOptions(source TargetSource, outputFile string, statInterval float64) {
+	qs.ctx.source = source
+	qs.ctx.total = source.Total()
+	qs.ctx.OutputFile = outputFile
+	qs.ctx.statInterval = int64(statInterval * 1e9)
+}
+
+// SetNormalize cleans up every target before it is queued, see
+// NormalizeHost, and optionally drops duplicates. Dropped lines are counted
+// by reason in the stats.
+func (qs *QueueScanner) SetNormalize(opts NormalizeOptions) {
+	qs.normalize = &opts
+}
+
+// SetProduct pairs every target with each item of a fresh inner source,
+// queuing join(target, item) instead of the target. It applies after
+// normalisation, so the pairs are not cleaned up as hosts, and the progress
+// total becomes the product of both sizes.
+func (qs *QueueScanner) SetProduct(inner func() TargetSource, join func(target, item string) string) {
+	qs.productInner = inner
+	qs.productJoin = join
+}
+
+// SetOrder sets the order targets are scanned in: sequential, random or
+// interleave, which spreads consecutive targets across subnets and parent
+// domains. The same seed gives the same order, as a resumed scan needs.
+func (qs *QueueScanner) SetOrder(order string, seed uint64) error {
+	if !ValidOrder(order) {
+		return fmt.Errorf("unknown order %q (want %s)", order, strings.Join(Orders, ", "))
 	}
+	qs.order = order
+	qs.seed = seed
+	return nil
+}
 
-	atomic.AddInt64(&ctx.SuccessCount, 1)
+// SetShard scans only shard index of count, numbered from 1. Targets are
+// assigned by a hash of the target as queued, after SetNormalize and
+// SetProduct if set, so instances given the same list, options and count
+// split it without overlap. The progress total becomes an
+// estimate of the shard size.
+func (qs *QueueScanner) SetShard(index, count int) error {
+	if count < 1 || index < 1 || index > count {
+		return fmt.Errorf("invalid shard %d/%d", index, count)
+	}
+	qs.shardIndex = index
+	qs.shardCount = count
+	return nil
+}
+
+// SetFailuresOutput writes every failed target with its failure class to
+// path, in the same format as the output file.
+func (qs *QueueScanner) SetFailuresOutput(path string) {
+	qs.ctx.FailuresFile = path
+}
+
+// SetGracePeriod sets how long Run waits for in-flight scans to finish after
+// its context is cancelled before returning anyway.
+func (qs *QueueScanner) SetGracePeriod(d time.Duration) {
+	qs.gracePeriod = d
 }
 
-func New(threads int, scanFunc func(c *Ctx, host string)) *QueueScanner {
-	scanner := &QueueScanner{
-		threads:  threads,
-		scanFunc: scanFunc,
-		queue:    make(chan string, threads*10), // Increased buffer
-		ctx: &Ctx{
-			maxResults:  getMaxResults(),
-			lastResults: make([]string, 0),
-		},
+// SetOutputFormat selects how hits are written to the output file: text,
+// jsonl or csv.
+func (qs *QueueScanner) SetOutputFormat(format string) error {
+	if !ValidOutputFormat(format) {
+		return fmt.Errorf("unknown output format %q (want %s)", format, strings.Join(OutputFormats, ", "))
 	}
+	qs.ctx.outputFormat = format
+	return nil
+}
+
+// SetColumns sets how results are laid out in the dashboard and text output.
+func (qs *QueueScanner) SetColumns(columns ...Column) {
+	qs.ctx.columns = columns
+}
 
-	for i := 0; i < scanner.threads; i++ {
-		scanner.wg.Add(1)
-		go scanner.run()
+// SetRenderer replaces the renderer picked by New, which is the same as
+// NewRenderer(UIAuto).
+func (qs *QueueScanner) SetRenderer(r Renderer) {
+	qs.ctx.renderer = r
+}
+
+// SetRateLimit caps how many scans are started per second across all
+// workers; burst is how many may start at once after an idle period. A rate
+// of 0 removes the limit.
+func (qs *QueueScanner) SetRateLimit(rate float64, burst int) {
+	qs.limiter.set(rate, burst)
+}
+
+// SetAutoThreads lets the scanner tune its worker count between min and max,
+// starting from the threads given to New and backing off whenever the share
+// of timeouts and connection errors rises.
+func (qs *QueueScanner) SetAutoThreads(min, max int) {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
 	}
+	qs.autoThreads = true
+	qs.minThreads = min
+	qs.maxThreads = max
+}
 
-	return scanner
+// SetRetries retries targets that failed with a retryable error (see
+// IsRetryable) up to n times, waiting backoff before the first retry and
+// doubling the wait on each further attempt.
+func (qs *QueueScanner) SetRetries(n int, backoff time.Duration) {
+	qs.retries = max(n, 0)
+	qs.retryBackoff = backoff
 }
 
-func (qs *QueueScanner) SetOptions(hostList []string, outputFile string, statInterval float64) {
-	qs.ctx.hostList = hostList
-	qs.ctx.OutputFile = outputFile
-	qs.ctx.statInterval = int64(statInterval * 1e9)
-	qs.ctx.maxResults = getMaxResults() // Update based on current terminal size
+// SetCheckpoint makes the scan resumable: progress is saved to path every
+// CheckpointInterval and when Run returns. Targets already recorded as
+// completed in cp are skipped.
+func (qs *QueueScanner) SetCheckpoint(path string, cp *Checkpoint) {
+	qs.checkpointPath = path
+	qs.checkpoint = cp
+	qs.progress = newProgressTracker(cp)
 }
 
-func (qs *QueueScanner) Start() {
-	qs.ctx.startTime = nowNano()
-	hideCursor()
-	defer showCursor()
+// Start runs the scan until every host is scanned or SIGINT/SIGTERM is
+// received. A second signal during the grace period terminates the process.
+func (qs *QueueScanner) Start() Summary {
+	return withSignals(qs.Run)
+}
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+// withSignals calls run with a context cancelled by SIGINT or SIGTERM
+func withSignals(run func(ctx context.Context) Summary) Summary {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	go func() {
-		<-sigChan
-		showCursor()
-		qs.ctx.PrintSummary()
-		os.Exit(0)
+		<-ctx.Done()
+		stop()
 	}()
 
+	return run(ctx)
+}
+
+// Run scans every target until the source is exhausted or ctx is cancelled.
+// On cancellation no new targets are dispatched and in-flight scans get the
+// grace period to finish; Run then prints the summary and returns.
+func (qs *QueueScanner) Run(ctx context.Context) Summary {
+	defer qs.ctx.source.Close()
+
+	if qs.remote != nil {
+		// The coordinator has already normalised, ordered and sharded the targets
+		defer qs.remote.Close()
+		qs.ctx.source = qs.remote
+		qs.ctx.total = -1
+	} else {
+		qs.prepareSource()
+	}
+
+	if err := qs.openWriters(); err != nil {
+		return Summary{Err: err}
+	}
+
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	qs.stop = stop
+
+	// Set up everything the stats read before the metrics and control
+	// servers can serve them
+	qs.ctx.baseCtx = ctx
+	qs.ctx.startTime = nowNano()
+	if qs.progress != nil && qs.ctx.total > 0 {
+		qs.ctx.total -= qs.checkpoint.skipCount()
+		if qs.ctx.total < 0 {
+			qs.ctx.total = 0
+		}
+	}
+
+	if qs.remote != nil {
+		qs.remote.start(ctx)
+	}
+
+	closeServers, err := qs.startServers()
+	if err != nil {
+		qs.ctx.closeWriter()
+		return Summary{Err: err}
+	}
+	defer closeServers()
+
+	qs.ctx.renderer.Start(qs.ctx.columns)
+
+	restoreTerminal := qs.startKeys()
+	defer restoreTerminal()
+
+	stopCheckpoints := make(chan struct{})
+	if qs.checkpointPath != "" {
+		go qs.saveCheckpoints(stopCheckpoints)
+	}
+
+	threads := qs.threads
+	if qs.autoThreads {
+		threads = min(max(threads, qs.minThreads), qs.maxThreads)
+	}
+	qs.setWorkers(threads)
+
+	stopAutoThreads := make(chan struct{})
+	defer close(stopAutoThreads)
+	if qs.autoThreads {
+		go qs.adjustThreads(stopAutoThreads)
+	}
+
 	// Initial display
 	qs.ctx.LogStat()
 
-	for _, host := range qs.ctx.hostList {
-		qs.queue <- host
+	// Feed from a separate goroutine so a source blocked on a slow read
+	// (e.g. stdin) cannot hold up shutdown past the grace period
+	fed := make(chan error, 1)
+	go func() {
+		err := qs.feed(ctx)
+		// Targets still in flight may come back for a retry
+		qs.outstanding.Wait()
+		close(qs.queue)
+		fed <- err
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		qs.wg.Wait()
+		close(done)
+	}()
+
+	var sourceErr error
+	select {
+	case <-done:
+		sourceErr = <-fed
+	case <-ctx.Done():
+		select {
+		case <-done:
+		case <-time.After(qs.gracePeriod):
+		}
+		select {
+		case sourceErr = <-fed:
+		default:
+		}
+	}
+
+	interrupted := ctx.Err() != nil
+	if sourceErr != nil {
+		interrupted = true
 	}
-	close(qs.queue)
+	atomic.StoreInt32(&qs.ctx.finished, 1)
 
-	qs.wg.Wait()
+	if qs.checkpointPath != "" {
+		close(stopCheckpoints)
+		if err := qs.saveCheckpoint(!interrupted); err != nil && sourceErr == nil {
+			sourceErr = fmt.Errorf("saving checkpoint: %w", err)
+		}
+	}
 
-	// Final summary
-	qs.ctx.PrintSummary()
+	// Final summary, with the terminal back in normal mode
+	restoreTerminal()
+	return qs.finish(interrupted, sourceErr)
+}
+
+// prepareSource wraps the target source in the configured order,
+// normalisation, product and shard
+func (qs *QueueScanner) prepareSource() {
+	qs.ctx.source = orderSource(qs.ctx.source, qs.order, qs.seed)
+	if qs.normalize != nil {
+		qs.ctx.source = newNormalizeSource(qs.ctx.source, *qs.normalize, &qs.ctx.dropped)
+	}
+	if qs.productInner != nil {
+		qs.ctx.source = NewProductSource(qs.ctx.source, qs.productInner, qs.productJoin)
+		qs.ctx.total = qs.ctx.source.Total()
+	}
+	if qs.shardCount > 1 {
+		qs.ctx.source = &shardSource{TargetSource: qs.ctx.source, index: qs.shardIndex - 1, count: qs.shardCount}
+		qs.ctx.total = qs.ctx.source.Total()
+	}
+}
+
+// openWriters opens the output and failures files, or for a worker the
+// writers reporting back to the coordinator
+func (qs *QueueScanner) openWriters() error {
+	if qs.remote != nil {
+		qs.ctx.writer = qs.remote.resultWriter(false)
+		qs.ctx.failureWriter = qs.remote.resultWriter(true)
+		return nil
+	}
+
+	if qs.ctx.OutputFile != "" {
+		writer, err := OpenResultWriter(qs.ctx.OutputFile, qs.ctx.outputFormat, qs.ctx.columns)
+		if err != nil {
+			return err
+		}
+		qs.ctx.writer = writer
+	}
+
+	if qs.ctx.FailuresFile != "" {
+		writer, err := OpenResultWriter(qs.ctx.FailuresFile, qs.ctx.outputFormat, FailureColumns)
+		if err != nil {
+			qs.ctx.closeWriter()
+			return err
+		}
+		qs.ctx.failureWriter = writer
+	}
+	return nil
+}
+
+// startServers starts the metrics and control servers that are configured;
+// the returned function shuts them down
+func (qs *QueueScanner) startServers() (func(), error) {
+	var servers []*http.Server
+	closeAll := func() {
+		for _, srv := range servers {
+			srv.Close()
+		}
+	}
+
+	if qs.metricsAddr != "" {
+		srv, err := qs.startMetrics()
+		if err != nil {
+			return nil, err
+		}
+		servers = append(servers, srv)
+	}
+
+	if qs.controlAddr != "" {
+		srv, err := qs.startControl()
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		servers = append(servers, srv)
+	}
+	return closeAll, nil
+}
+
+// finish closes the output, renders the summary and returns it
+func (qs *QueueScanner) finish(interrupted bool, err error) Summary {
+	if cerr := qs.ctx.closeWriter(); cerr != nil && err == nil {
+		err = fmt.Errorf("writing output: %w", cerr)
+	}
+
+	qs.ctx.PrintSummary(interrupted)
+
+	return Summary{
+		Total:       atomic.LoadInt64(&qs.ctx.total),
+		Completed:   atomic.LoadInt64(&qs.ctx.ScanComplete),
+		Success:     atomic.LoadInt64(&qs.ctx.SuccessCount),
+		Elapsed:     time.Duration(nowNano() - qs.ctx.startTime),
+		Interrupted: interrupted,
+		Err:         err,
+	}
+}
+
+// feed pulls targets from the source into the queue until it is exhausted
+// or ctx is cancelled
+func (qs *QueueScanner) feed(ctx context.Context) error {
+	var index, count int64
+	for ; ; index++ {
+		target, err := qs.ctx.source.Next()
+		if err == io.EOF {
+			// The exact total is known now, replace the estimate
+			atomic.StoreInt64(&qs.ctx.total, count)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if qs.progress != nil && qs.progress.shouldSkip(index) {
+			qs.progress.markDone(index)
+			atomic.AddInt64(&qs.ctx.resumed, 1)
+			continue
+		}
+
+		qs.outstanding.Add(1)
+		select {
+		case qs.queue <- queueItem{index: index, target: target}:
+			count++
+		case <-ctx.Done():
+			qs.outstanding.Done()
+			return nil
+		}
+	}
+}
+
+// saveCheckpoints persists progress every CheckpointInterval until stop is closed
+func (qs *QueueScanner) saveCheckpoints(stop <-chan struct{}) {
+	ticker := time.NewTicker(CheckpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// A failed save is retried on the next tick and reported by Run
+			_ = qs.saveCheckpoint(false)
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (qs *QueueScanner) saveCheckpoint(finished bool) error {
+	qs.checkpointMu.Lock()
+	defer qs.checkpointMu.Unlock()
+
+	// Snapshot progress before flushing so the checkpoint never records a
+	// target whose hit is still sitting in the output buffer
+	qs.progress.fill(qs.checkpoint)
+	qs.checkpoint.Finished = finished
+	if err := qs.ctx.flushWriter(); err != nil {
+		return err
+	}
+	return qs.checkpoint.Save(qs.checkpointPath)
 }
 
 func (qs *QueueScanner) run() {
 	defer qs.wg.Done()
 
 	for {
-		host, ok := <-qs.queue
+		if qs.retireWorker() {
+			return
+		}
+
+		item, ok := <-qs.queue
 		if !ok {
-			break
+			qs.workerDone()
+			return
 		}
 
-		qs.scanFunc(qs.ctx, host)
+		if qs.scan(item) {
+			qs.outstanding.Done()
+		}
+	}
+}
+
+// scan probes one queued target and records the outcome. It returns false
+// when the target was handed back for another attempt instead.
+func (qs *QueueScanner) scan(item queueItem) bool {
+	// Drain without scanning once the scan has been cancelled
+	if qs.ctx.Context().Err() != nil {
+		return true
+	}
 
-		atomic.AddInt64(&qs.ctx.ScanComplete, 1)
-		qs.ctx.LogStat()
+	if err := qs.limiter.wait(qs.ctx.Context()); err != nil {
+		return true
 	}
+
+	// Checked after the limiter so workers queued for a token stop too
+	if err := qs.ctx.pause.wait(qs.ctx.Context()); err != nil {
+		return true
+	}
+
+	atomic.AddInt64(&qs.ctx.started, 1)
+	start := time.Now()
+	scanCtx := &Ctx{runState: qs.ctx.runState, item: &item}
+	err := qs.scanFunc(scanCtx, item.target)
+	if qs.ctx.Context().Err() == nil {
+		if err == nil {
+			qs.ctx.latencySuccess.observe(time.Since(start))
+		} else {
+			qs.ctx.latencyFailure.observe(time.Since(start))
+		}
+	}
+	if isCongestionError(err) {
+		atomic.AddInt64(&qs.ctx.congested, 1)
+	}
+	if err != nil && qs.ctx.Context().Err() == nil {
+		if item.attempt < qs.retries && IsRetryable(err) {
+			qs.retry(item)
+			return false
+		}
+		scanCtx.recordFailure(item.target, err)
+	}
+
+	// A scan cut short by cancellation is repeated on resume
+	if qs.progress != nil && qs.ctx.Context().Err() == nil {
+		qs.progress.markDone(item.index)
+	}
+	// and by another worker of a coordinator
+	if qs.remote != nil && qs.ctx.Context().Err() == nil {
+		qs.remote.completed(item.index)
+	}
+
+	atomic.AddInt64(&qs.ctx.ScanComplete, 1)
+	qs.ctx.LogStat()
+	return true
 }
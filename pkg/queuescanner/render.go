@@ -0,0 +1,635 @@
+package queuescanner
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// UI modes accepted by NewRenderer
+const (
+	UIAuto   = "auto"
+	UITTY    = "tty"
+	UILine   = "line"
+	UISilent = "silent"
+)
+
+// Renderer presents a running scan. Result and Progress may be called from
+// several workers at once, so implementations must be safe for concurrent use.
+type Renderer interface {
+	// Start is called once before scanning begins.
+	Start(columns []Column)
+	// Result is called for every result reported; hit marks successes.
+	// Failed targets are reported too, with ErrorClass set.
+	Result(res *Result, hit bool)
+	// Progress is called at the stat interval with fresh stats.
+	Progress(stats Stats)
+	// Summary is called once when the scan has ended.
+	Summary(stats Stats)
+}
+
+// NewRenderer returns the renderer for a UI mode. "auto" picks the full
+// screen dashboard when stdout is a terminal and line progress otherwise.
+func NewRenderer(mode string) (Renderer, error) {
+	switch mode {
+	case UIAuto, "":
+		return defaultRenderer(), nil
+	case UITTY:
+		return NewTTYRenderer(os.Stdout), nil
+	case UILine:
+		return NewLineRenderer(os.Stdout, os.Stderr), nil
+	case UISilent:
+		return NewSilentRenderer(os.Stdout), nil
+	}
+	return nil, fmt.Errorf("unknown ui %q (want auto, tty, line or silent)", mode)
+}
+
+func defaultRenderer() Renderer {
+	if term.IsTerminal(int(os.Stdout.Fd())) {
+		return NewTTYRenderer(os.Stdout)
+	}
+	return NewLineRenderer(os.Stdout, os.Stderr)
+}
+
+func formatETA(eta time.Duration) string {
+	if eta < 0 {
+		return "--"
+	}
+	return eta.Truncate(time.Second).String()
+}
+
+func formatTotal(total int64) string {
+	if total < 0 {
+		return "?"
+	}
+	return fmt.Sprint(total)
+}
+
+func formatDuration(d time.Duration) string {
+	return d.Truncate(time.Second).String()
+}
+
+// failureShortLabels fit the failure breakdown into the progress box
+var failureShortLabels = [numFailureClasses]string{
+	FailureOther:            "Other",
+	FailureDNS:              "DNS",
+	FailureConnectRefused:   "Refused",
+	FailureConnectTimeout:   "Conn T/O",
+	FailureTLSHandshake:     "TLS",
+	FailureReadTimeout:      "Read T/O",
+	FailureUnexpectedStatus: "Status",
+	FailureFiltered:         "Filtered",
+	FailureCertificate:      "Cert",
+}
+
+// formatFailures renders the non-zero failure counts as name=count pairs
+func formatFailures(failures [numFailureClasses]int64) string {
+	var parts []string
+	for _, class := range FailureClasses {
+		if n := failures[class]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%d", class, n))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// formatDropped renders the non-zero dropped line counts as name=count pairs
+func formatDropped(dropped [numDropReasons]int64) string {
+	var parts []string
+	for _, reason := range DropReasons {
+		if n := dropped[reason]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%d", reason, n))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// formatStage summarises one pipeline stage
+func formatStage(i int, stage StageStats) string {
+	state := "waiting"
+	switch {
+	case stage.Done:
+		state = "done"
+	case stage.Started && stage.Paused:
+		state = "paused"
+	case stage.Started:
+		state = "running"
+	}
+	return fmt.Sprintf("%d. %-8s %-8s scanned=%d/%s passed=%d failed=%d",
+		i+1, stage.Name, state, stage.Completed, formatTotal(stage.Total), stage.Success, stage.Failed)
+}
+
+// formatLatency renders a duration compactly, to a precision that matches
+// the percentiles
+func formatLatency(d time.Duration) string {
+	switch {
+	case d <= 0:
+		return "-"
+	case d < 10*time.Millisecond:
+		return d.Round(100 * time.Microsecond).String()
+	case d < 10*time.Second:
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
+
+// formatPercentiles renders the p50, p90 and p99 of a phase
+func formatPercentiles(p Percentiles) string {
+	return fmt.Sprintf("p50=%s p90=%s p99=%s", formatLatency(p.P50), formatLatency(p.P90), formatLatency(p.P99))
+}
+
+func formatRateLimit(limit float64) string {
+	if limit <= 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%.1f/s", limit)
+}
+
+// ttyRenderer redraws a full-screen dashboard with the latest results
+type ttyRenderer struct {
+	mu          sync.Mutex
+	out         io.Writer
+	columns     []Column
+	lastResults []logEntry // Buffer for last N results
+	maxResults  int        // Dynamic based on screen height
+
+	raw          bool // the terminal is in raw mode for keyboard controls
+	showFailures bool
+	notice       string // short message shown in the footer after a key press
+	noticeTime   time.Time
+}
+
+// noticeDuration is how long a notice stays in the dashboard footer
+const noticeDuration = 5 * time.Second
+
+// NewTTYRenderer returns the full-screen dashboard renderer.
+func NewTTYRenderer(out io.Writer) Renderer {
+	return &ttyRenderer{out: out, maxResults: getMaxResults()}
+}
+
+func hideCursor(w io.Writer) {
+	fmt.Fprint(w, "\033[?25l")
+}
+
+func showCursor(w io.Writer) {
+	fmt.Fprint(w, "\033[?25h")
+}
+
+func printBanner(w io.Writer) {
+	banner := `  ______ _           _      _____
+ |  ____| |         | |    / ____|
+ | |__  | | __ _ ___| |__ | (___   ___ __ _ _ __
+ |  __| | |/ _` + "`" + ` / __| '_ \ \___ \ / __/ _` + "`" + ` | '_ \
+ | |    | | (_| \__ \ | | |____) | (_| (_| | | | |
+ |_|    |_|\__,_|___/_| |_|_____/ \___\__,_|_| |_| v2.0`
+	fmt.Fprintf(w, "%s%s%s\n", ColorCyan+ColorBold, banner, ColorReset)
+}
+
+// Calculate dynamic max results based on terminal height
+func getMaxResults() int {
+	_, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return 10 // Default fallback
+	}
+
+	// Banner: 4 lines
+	// Progress box: 13 lines
+	// Header: 2 lines
+	// Table header: 3 lines
+	// Footer: 2 lines
+	// Total overhead: ~24 lines
+
+	available := height - 24
+	if available < 5 {
+		return 5 // Minimum
+	}
+	if available > 50 {
+		return 50 // Maximum
+	}
+	return available
+}
+
+// Helper to calculate visual width of a string (accounting for ANSI and wide chars)
+func visualWidth(s string) int {
+	w := 0
+	inEscape := false
+	for _, r := range s {
+		if r == '\033' {
+			inEscape = true
+			continue
+		}
+		if inEscape {
+			if r == 'm' {
+				inEscape = false
+			}
+			continue
+		}
+		// Estimating cell width: Emojis and some special chars are usually 2 cells
+		if r > 0x1F000 || r == 0x26A1 || r == 0x2714 || r == 0x2716 || r == 0x23F1 {
+			w += 2
+		} else {
+			w += 1
+		}
+	}
+	return w
+}
+
+func printBoxLine(w io.Writer, content string) {
+	padding := 67 - visualWidth(content)
+	if padding < 0 {
+		padding = 0
+	}
+	fmt.Fprintf(w, "%s%s%s┃%s\n", ColorBlue, content, strings.Repeat(" ", padding), ColorReset)
+}
+
+func (r *ttyRenderer) Start(columns []Column) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.columns = columns
+	r.maxResults = getMaxResults() // Update based on current terminal size
+	hideCursor(r.out)
+}
+
+// Add result to buffer
+func (r *ttyRenderer) Result(res *Result, hit bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if res.ErrorClass != "" && !hit && !r.showFailures {
+		return
+	}
+	r.lastResults = append(r.lastResults, logEntry{result: res, hit: hit})
+	// Keep only last N results
+	if len(r.lastResults) > r.maxResults {
+		r.lastResults = r.lastResults[1:]
+	}
+}
+
+// Redraw entire screen with progress and results
+func (r *ttyRenderer) Progress(stats Stats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Progress bar - FIXED: prevent negative repeat counts
+	barWidth := 40
+	filled := int(stats.Percent / 100 * float64(barWidth))
+	if filled < 0 {
+		filled = 0
+	}
+	if filled > barWidth {
+		filled = barWidth
+	}
+	remaining := barWidth - filled
+	bar := ColorGreen + strings.Repeat("━", filled) + ColorWhite + strings.Repeat("─", remaining) + ColorReset
+
+	// Render the frame off-screen and write it at once to avoid flicker
+	var w bytes.Buffer
+
+	// Clear screen and redraw
+	fmt.Fprint(&w, "\033[2J\033[H")
+
+	// Banner
+	printBanner(&w)
+	fmt.Fprintln(&w)
+
+	// Progress box
+	fmt.Fprintf(&w, "%s┏━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━┓%s\n", ColorBlue, ColorReset)
+
+	// Progress bar line
+	state := "⚡ SCANNING..."
+	if stats.Paused {
+		state = "⏸  PAUSED...   "
+	}
+	progressLine := fmt.Sprintf("┃ %s%s %s[%s] %s%.1f%%%s",
+		ColorWhite+ColorBold, state, ColorReset, bar, ColorMagenta, stats.Percent, ColorReset)
+	printBoxLine(&w, progressLine)
+
+	fmt.Fprintf(&w, "%s┠──────────────────────────────────────────────────────────────────┨%s\n", ColorBlue, ColorReset)
+
+	// Stats line 1
+	statsLine1 := fmt.Sprintf("┃ %s✔ Success: %s%-5d %s┃ %s✖ Failed: %s%-5d %s┃ %s🚀 Speed: %s%-6.0f ",
+		ColorGreen, ColorWhite, stats.Success, ColorBlue,
+		ColorRed, ColorWhite, stats.Failed, ColorBlue,
+		ColorMagenta, ColorWhite, stats.Speed)
+	printBoxLine(&w, statsLine1)
+
+	// Stats line 2
+	statsLine2 := fmt.Sprintf("┃ %s⏱  ETA: %s%-12s %s┃ %s📂 Scanned: %s%d/%s %s┃ %s🔁 Retries: %s%-5d ",
+		ColorYellow, ColorWhite, formatETA(stats.ETA), ColorBlue,
+		ColorCyan, ColorWhite, stats.Completed, formatTotal(stats.Total), ColorBlue,
+		ColorYellow, ColorWhite, stats.Retries)
+	printBoxLine(&w, statsLine2)
+
+	// Stats line 3
+	statsLine3 := fmt.Sprintf("┃ %s🔌 Rate: %s%-9s %s┃ %s🎯 Limit: %s%-9s %s┃ %s🧵 Threads: %s%-5d ",
+		ColorMagenta, ColorWhite, fmt.Sprintf("%.1f/s", stats.Rate), ColorBlue,
+		ColorYellow, ColorWhite, formatRateLimit(stats.RateLimit), ColorBlue,
+		ColorCyan, ColorWhite, stats.Workers)
+	printBoxLine(&w, statsLine3)
+
+	// Failure breakdown, four classes per row
+	fmt.Fprintf(&w, "%s┠──────────────────────────────────────────────────────────────────┨%s\n", ColorBlue, ColorReset)
+	for row := 0; row < len(FailureClasses); row += 4 {
+		line := "┃ "
+		for _, class := range FailureClasses[row:min(row+4, len(FailureClasses))] {
+			line += fmt.Sprintf("%s%s: %s%-6d", ColorRed, failureShortLabels[class], ColorWhite, stats.Failures[class])
+		}
+		printBoxLine(&w, line)
+	}
+
+	// Latency of the hits: percentiles of the whole probe, then the median
+	// of each phase
+	fmt.Fprintf(&w, "%s┠──────────────────────────────────────────────────────────────────┨%s\n", ColorBlue, ColorReset)
+	total := stats.Latency[PhaseTotal]
+	printBoxLine(&w, fmt.Sprintf("┃ %sLatency %sp50: %s%-9s%sp90: %s%-9s%sp99: %s%-9s",
+		ColorCyan, ColorYellow, ColorWhite, formatLatency(total.P50),
+		ColorYellow, ColorWhite, formatLatency(total.P90),
+		ColorYellow, ColorWhite, formatLatency(total.P99)))
+	line := fmt.Sprintf("┃ %sMedian  ", ColorCyan)
+	for _, phase := range Phases[1:] {
+		line += fmt.Sprintf("%s%s: %s%-8s", ColorYellow, phase.Label(), ColorWhite, formatLatency(stats.Latency[phase].P50))
+	}
+	printBoxLine(&w, line)
+
+	// Pipeline stages, each passing its hits on to the next
+	if len(stats.Stages) > 0 {
+		fmt.Fprintf(&w, "%s┠──────────────────────────────────────────────────────────────────┨%s\n", ColorBlue, ColorReset)
+		for i, stage := range stats.Stages {
+			printBoxLine(&w, fmt.Sprintf("┃ %s%s", ColorWhite, formatStage(i, stage)))
+		}
+	}
+
+	fmt.Fprintf(&w, "%s┗━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━┛%s\n", ColorBlue, ColorReset)
+	fmt.Fprintln(&w)
+
+	// Results table
+	fmt.Fprintf(&w, "%s✅ LATEST %d RESULTS:%s\n", ColorGreen+ColorBold, r.maxResults, ColorReset)
+	fmt.Fprintf(&w, "%s%s%s\n", ColorCyan+ColorBold, FormatHeader(r.columns), ColorReset)
+
+	if len(r.lastResults) > 0 {
+		for _, entry := range r.lastResults {
+			// Failures do not have the fields of the scanner's columns
+			if !entry.hit && entry.result.ErrorClass != "" {
+				fmt.Fprintf(&w, "%s%s%s\n", ColorRed, FormatText(FailureColumns, entry.result), ColorReset)
+				continue
+			}
+			// Color code based on the result fields
+			color := resultColor(entry.result)
+			if color == "" && entry.hit {
+				color = ColorGreen
+			}
+			fmt.Fprintf(&w, "%s%s%s\n", color, FormatText(r.columns, entry.result), ColorReset)
+		}
+	} else {
+		fmt.Fprintf(&w, "%sWaiting for results...%s\n", ColorCyan, ColorReset)
+	}
+
+	// Footer info
+	if stats.OutputFile != "" {
+		fmt.Fprintf(&w, "\n%s💾 Results saved to:%s %s%s%s\n",
+			ColorGreen, ColorReset, ColorCyan, stats.OutputFile, ColorReset)
+	}
+
+	// Keyboard help and the outcome of the last key press
+	if r.raw {
+		failures := "show"
+		if r.showFailures {
+			failures = "hide"
+		}
+		fmt.Fprintf(&w, "\n%s⌨  [p] pause/resume  [+/-] threads  [s] save  [f] %s failures  [q] quit%s\n",
+			ColorCyan, failures, ColorReset)
+		if r.notice != "" && time.Since(r.noticeTime) < noticeDuration {
+			fmt.Fprintf(&w, "%s» %s%s\n", ColorYellow, r.notice, ColorReset)
+		}
+	}
+
+	r.write(w.Bytes())
+}
+
+// Print final summary
+func (r *ttyRenderer) Summary(stats Stats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	title := "📊 SCAN COMPLETED          "
+	if stats.Interrupted {
+		title = "⛔ SCAN INTERRUPTED        "
+	}
+
+	var w bytes.Buffer
+	fmt.Fprint(&w, "\033[2J\033[H")
+
+	fmt.Fprintf(&w, "\n%s╔══════════════════════════════════════════════════════════════════╗%s\n", ColorGreen+ColorBold, ColorReset)
+	fmt.Fprintf(&w, "%s║                    %s                   ║%s\n", ColorGreen+ColorBold, title, ColorReset)
+	fmt.Fprintf(&w, "%s╚══════════════════════════════════════════════════════════════════╝%s\n\n", ColorGreen+ColorBold, ColorReset)
+
+	fmt.Fprintf(&w, "%s📈 Statistics:%s\n", ColorBlue+ColorBold, ColorReset)
+	fmt.Fprintf(&w, "   • Total Scanned: %s%d/%s%s hosts\n", ColorMagenta, stats.Completed, formatTotal(stats.Total), ColorReset)
+	if stats.Completed > 0 {
+		fmt.Fprintf(&w, "   • %sSuccessful:%s %s%d%s (%.1f%%)\n",
+			ColorGreen, ColorReset, ColorGreen, stats.Success, ColorReset,
+			float64(stats.Success)/float64(stats.Completed)*100)
+		fmt.Fprintf(&w, "   • %sFailed:%s %s%d%s (%.1f%%)\n",
+			ColorRed, ColorReset, ColorRed, stats.Failed, ColorReset,
+			float64(stats.Failed)/float64(stats.Completed)*100)
+		for _, class := range FailureClasses {
+			if n := stats.Failures[class]; n > 0 {
+				fmt.Fprintf(&w, "       - %s: %s%d%s (%.1f%%)\n",
+					class.Label(), ColorRed, n, ColorReset,
+					float64(n)/float64(stats.Completed)*100)
+			}
+		}
+	}
+	if len(stats.Stages) > 0 {
+		fmt.Fprintf(&w, "   • Stages:\n")
+		for i, stage := range stats.Stages {
+			fmt.Fprintf(&w, "       %s\n", formatStage(i, stage))
+		}
+	}
+	if stats.Latency[PhaseTotal].Count > 0 {
+		fmt.Fprintf(&w, "   • Latency of hits:\n")
+		for _, phase := range Phases {
+			if p := stats.Latency[phase]; p.Count > 0 {
+				fmt.Fprintf(&w, "       - %-8s %s%s%s\n", phase.Label()+":", ColorCyan, formatPercentiles(p), ColorReset)
+			}
+		}
+	}
+	if stats.Retries > 0 {
+		fmt.Fprintf(&w, "   • Retries: %s%d%s extra attempts after transient failures\n", ColorYellow, stats.Retries, ColorReset)
+	}
+	if stats.Resumed > 0 {
+		fmt.Fprintf(&w, "   • Resumed: %s%d%s hosts skipped from previous run\n", ColorMagenta, stats.Resumed, ColorReset)
+	}
+	if dropped := formatDropped(stats.Dropped); dropped != "" {
+		fmt.Fprintf(&w, "   • Dropped input lines: %s%s%s\n", ColorYellow, dropped, ColorReset)
+	}
+	fmt.Fprintf(&w, "   • Time Elapsed: %s%s%s\n", ColorMagenta, formatDuration(stats.Elapsed), ColorReset)
+
+	if stats.Elapsed > 0 {
+		fmt.Fprintf(&w, "   • Average Speed: %s%.1f hosts/sec%s\n",
+			ColorMagenta, stats.Speed, ColorReset)
+	}
+
+	if stats.OutputFile != "" {
+		fmt.Fprintf(&w, "\n%s💾 Results saved to:%s %s%s%s\n",
+			ColorGreen, ColorReset, ColorCyan, stats.OutputFile, ColorReset)
+	}
+	if stats.FailuresFile != "" {
+		fmt.Fprintf(&w, "%s💾 Failures saved to:%s %s%s%s\n",
+			ColorRed, ColorReset, ColorCyan, stats.FailuresFile, ColorReset)
+	}
+
+	fmt.Fprintf(&w, "\n%s✨ Thank you for using FlashScan-Go! ✨%s\n\n",
+		ColorGreen+ColorBold, ColorReset)
+
+	showCursor(&w)
+	r.write(w.Bytes())
+}
+
+// write outputs a frame; raw mode does not turn "\n" into "\r\n" by itself
+func (r *ttyRenderer) write(frame []byte) {
+	if r.raw {
+		frame = bytes.ReplaceAll(frame, []byte("\n"), []byte("\r\n"))
+	}
+	r.out.Write(frame)
+}
+
+func (r *ttyRenderer) setRaw(raw bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.raw = raw
+}
+
+func (r *ttyRenderer) toggleFailures() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.showFailures = !r.showFailures
+	if !r.showFailures {
+		// Drop the failures already listed so the hits come back into view
+		kept := r.lastResults[:0]
+		for _, entry := range r.lastResults {
+			if entry.hit || entry.result.ErrorClass == "" {
+				kept = append(kept, entry)
+			}
+		}
+		r.lastResults = kept
+	}
+	return r.showFailures
+}
+
+func (r *ttyRenderer) notify(msg string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notice = msg
+	r.noticeTime = time.Now()
+}
+
+// lineRenderer streams hits to out and writes one progress line per interval
+// to log, so stdout can be piped while progress stays visible on stderr
+type lineRenderer struct {
+	mu      sync.Mutex
+	out     io.Writer
+	log     io.Writer
+	columns []Column
+}
+
+// NewLineRenderer returns a renderer for pipes, cron and systemd: plain
+// result lines on out and plain progress lines on log.
+func NewLineRenderer(out, log io.Writer) Renderer {
+	return &lineRenderer{out: out, log: log}
+}
+
+func (r *lineRenderer) Start(columns []Column) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.columns = columns
+}
+
+func (r *lineRenderer) Result(res *Result, hit bool) {
+	if !hit {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fmt.Fprintln(r.out, FormatText(r.columns, res))
+}
+
+func (r *lineRenderer) Progress(stats Stats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	line := fmt.Sprintf("[flashscan] %d/%s (%.1f%%) success=%d failed=%d retries=%d speed=%.1f/s rate=%.1f/s threads=%d eta=%s",
+		stats.Completed, formatTotal(stats.Total), stats.Percent,
+		stats.Success, stats.Failed, stats.Retries, stats.Speed, stats.Rate, stats.Workers, formatETA(stats.ETA))
+	if failures := formatFailures(stats.Failures); failures != "" {
+		line += " " + failures
+	}
+	if total := stats.Latency[PhaseTotal]; total.Count > 0 {
+		line += fmt.Sprintf(" latency_p50=%s latency_p90=%s latency_p99=%s",
+			formatLatency(total.P50), formatLatency(total.P90), formatLatency(total.P99))
+	}
+	if stats.Paused {
+		line += " paused"
+	}
+	for _, stage := range stats.Stages {
+		line += fmt.Sprintf(" %s=%d/%s:%d", stage.Name, stage.Completed, formatTotal(stage.Total), stage.Success)
+	}
+	fmt.Fprintln(r.log, line)
+}
+
+func (r *lineRenderer) Summary(stats Stats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state := "completed"
+	if stats.Interrupted {
+		state = "interrupted"
+	}
+	fmt.Fprintf(r.log, "[flashscan] scan %s: scanned=%d/%s success=%d failed=%d retries=%d elapsed=%s speed=%.1f/s\n",
+		state, stats.Completed, formatTotal(stats.Total),
+		stats.Success, stats.Failed, stats.Retries, formatDuration(stats.Elapsed), stats.Speed)
+	if failures := formatFailures(stats.Failures); failures != "" {
+		fmt.Fprintf(r.log, "[flashscan] failures: %s\n", failures)
+	}
+	for _, phase := range Phases {
+		if p := stats.Latency[phase]; p.Count > 0 {
+			fmt.Fprintf(r.log, "[flashscan] latency %s: %s\n", phase, formatPercentiles(p))
+		}
+	}
+	for i, stage := range stats.Stages {
+		fmt.Fprintf(r.log, "[flashscan] stage %s\n", formatStage(i, stage))
+	}
+	if stats.Resumed > 0 {
+		fmt.Fprintf(r.log, "[flashscan] resumed: %d hosts skipped from previous run\n", stats.Resumed)
+	}
+	if dropped := formatDropped(stats.Dropped); dropped != "" {
+		fmt.Fprintf(r.log, "[flashscan] dropped input: %s\n", dropped)
+	}
+	if stats.OutputFile != "" {
+		fmt.Fprintf(r.log, "[flashscan] results saved to %s\n", stats.OutputFile)
+	}
+	if stats.FailuresFile != "" {
+		fmt.Fprintf(r.log, "[flashscan] failures saved to %s\n", stats.FailuresFile)
+	}
+}
+
+// silentRenderer prints nothing but the hits
+type silentRenderer struct {
+	lineRenderer
+}
+
+// NewSilentRenderer returns a renderer that only writes hits to out.
+func NewSilentRenderer(out io.Writer) Renderer {
+	return &silentRenderer{lineRenderer{out: out}}
+}
+
+func (r *silentRenderer) Progress(Stats) {}
+func (r *silentRenderer) Summary(Stats)  {}
@@ -0,0 +1,319 @@
+package queuescanner
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Result is the structured outcome of probing one target. Scan functions
+// fill in what they learned; rendering is left to the dashboard and writers.
+type Result struct {
+	Target     string            `json:"target"`
+	IP         string            `json:"ip,omitempty"`
+	Port       int               `json:"port,omitempty"`
+	Status     int               `json:"status,omitempty"` // HTTP status code, 0 when the probe is not HTTP
+	Server     string            `json:"server,omitempty"`
+	Location   string            `json:"location,omitempty"`
+	Latency    time.Duration     `json:"-"` // encoded as latency_ms
+	Timing     *Timing           `json:"timing,omitempty"`
+	TLS        *TLSInfo          `json:"tls,omitempty"`
+	ErrorClass string            `json:"error_class,omitempty"`
+	Fields     map[string]string `json:"fields,omitempty"` // probe specific extras, e.g. the raw status line
+}
+
+// MarshalJSON encodes the result with its latency in milliseconds.
+func (r *Result) MarshalJSON() ([]byte, error) {
+	type plain Result
+	return json.Marshal(struct {
+		*plain
+		LatencyMS float64 `json:"latency_ms,omitempty"`
+	}{(*plain)(r), float64(r.Latency) / float64(time.Millisecond)})
+}
+
+// UnmarshalJSON decodes a result written by MarshalJSON.
+func (r *Result) UnmarshalJSON(data []byte) error {
+	type plain Result
+	var v struct {
+		*plain
+		LatencyMS float64 `json:"latency_ms"`
+	}
+	v.plain = (*plain)(r)
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	r.Latency = time.Duration(v.LatencyMS * float64(time.Millisecond))
+	return nil
+}
+
+// TLSInfo describes the negotiated TLS session.
+type TLSInfo struct {
+	Version     string `json:"version"`
+	CipherSuite string `json:"cipher_suite"`
+	ServerName  string `json:"server_name,omitempty"`
+	ALPN        string `json:"alpn,omitempty"`
+
+	Certificate  *CertInfo  `json:"certificate,omitempty"`  // the leaf certificate, when captured
+	Verification CertStatus `json:"verification,omitempty"` // set when the certificate was verified
+}
+
+// NewTLSInfo summarises a completed handshake.
+func NewTLSInfo(state tls.ConnectionState) *TLSInfo {
+	return &TLSInfo{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ServerName:  state.ServerName,
+		ALPN:        state.NegotiatedProtocol,
+	}
+}
+
+// CertInfo describes a certificate presented by the server.
+type CertInfo struct {
+	Subject   string    `json:"subject"` // common name
+	SANs      []string  `json:"sans,omitempty"`
+	Issuer    string    `json:"issuer"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	KeyType   string    `json:"key_type"`
+	Serial    string    `json:"serial"`
+}
+
+// NewCertInfo summarises a certificate.
+func NewCertInfo(cert *x509.Certificate) *CertInfo {
+	issuer := cert.Issuer.CommonName
+	if issuer == "" {
+		issuer = cert.Issuer.String()
+	}
+
+	sans := append([]string(nil), cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+
+	return &CertInfo{
+		Subject:   cert.Subject.CommonName,
+		SANs:      sans,
+		Issuer:    issuer,
+		NotBefore: cert.NotBefore.UTC(),
+		NotAfter:  cert.NotAfter.UTC(),
+		KeyType:   keyType(cert),
+		Serial:    fmt.Sprintf("%X", cert.SerialNumber),
+	}
+}
+
+// keyType names the public key algorithm and size, e.g. RSA-2048 or
+// ECDSA-P256
+func keyType(cert *x509.Certificate) string {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA-%d", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA-" + key.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+	return cert.PublicKeyAlgorithm.String()
+}
+
+// cert returns the captured certificate, or nil
+func (r *Result) cert() *CertInfo {
+	if r.TLS == nil {
+		return nil
+	}
+	return r.TLS.Certificate
+}
+
+// certValue returns value(cert) if a certificate was captured
+func certValue(value func(c *CertInfo) string) func(r *Result) string {
+	return func(r *Result) string {
+		if c := r.cert(); c != nil {
+			return value(c)
+		}
+		return ""
+	}
+}
+
+// tlsValue returns value(info) if the result has TLS details
+func tlsValue(value func(info *TLSInfo) string) func(r *Result) string {
+	return func(r *Result) string {
+		if r.TLS != nil {
+			return value(r.TLS)
+		}
+		return ""
+	}
+}
+
+// Address returns IP:port, or just the IP when no port is known.
+func (r *Result) Address() string {
+	if r.Port == 0 {
+		return r.IP
+	}
+	return net.JoinHostPort(r.IP, strconv.Itoa(r.Port))
+}
+
+// SetField stores a probe specific value.
+func (r *Result) SetField(key, value string) {
+	if r.Fields == nil {
+		r.Fields = make(map[string]string)
+	}
+	r.Fields[key] = value
+}
+
+// Column is one column of the text rendering of a result.
+type Column struct {
+	Header string
+	Width  int // padding width, 0 leaves the value unpadded
+	Value  func(r *Result) string
+}
+
+// Named returns a copy of the column with a different header.
+func (c Column) Named(header string) Column {
+	c.Header = header
+	return c
+}
+
+// Standard columns shared by the scan commands
+var (
+	ColumnIP = Column{Header: "IP ADDRESS", Width: 16, Value: func(r *Result) string {
+		return r.IP
+	}}
+	ColumnAddress = Column{Header: "ADDRESS", Width: 32, Value: func(r *Result) string {
+		return r.Address()
+	}}
+	ColumnTarget = Column{Header: "HOST", Width: 20, Value: func(r *Result) string {
+		return r.Target
+	}}
+	ColumnTargetPort = Column{Header: "HOST", Value: func(r *Result) string {
+		if r.Port == 0 {
+			return r.Target
+		}
+		return net.JoinHostPort(r.Target, strconv.Itoa(r.Port))
+	}}
+	ColumnStatus = Column{Header: "CODE", Width: 4, Value: func(r *Result) string {
+		if r.Status == 0 {
+			return ""
+		}
+		return strconv.Itoa(r.Status)
+	}}
+	ColumnServer = Column{Header: "SERVER", Width: 16, Value: func(r *Result) string {
+		return r.Server
+	}}
+	ColumnResponse = Column{Header: "RESPONSE", Value: func(r *Result) string {
+		var parts []string
+		if line := r.Fields["status_line"]; line != "" {
+			parts = append(parts, line)
+		} else if r.Status != 0 {
+			parts = append(parts, strconv.Itoa(r.Status))
+		}
+		if r.Server != "" {
+			parts = append(parts, "Server: "+r.Server)
+		}
+		if r.Location != "" {
+			parts = append(parts, "Location: "+r.Location)
+		}
+		return strings.Join(parts, " -- ")
+	}}
+	ColumnErrorClass = Column{Header: "FAILURE", Width: 18, Value: func(r *Result) string {
+		return r.ErrorClass
+	}}
+	ColumnError = Column{Header: "ERROR", Value: func(r *Result) string {
+		return r.Fields["error"]
+	}}
+	ColumnLatency = Column{Header: "LATENCY", Width: 8, Value: func(r *Result) string {
+		if r.Latency == 0 {
+			return ""
+		}
+		return r.Latency.Round(time.Millisecond).String()
+	}}
+
+	ColumnTLSVersion = Column{Header: "TLS", Width: 7, Value: tlsValue(func(info *TLSInfo) string {
+		return info.Version
+	})}
+	ColumnCipherSuite = Column{Header: "CIPHER", Width: 38, Value: tlsValue(func(info *TLSInfo) string {
+		return info.CipherSuite
+	})}
+	ColumnALPN = Column{Header: "ALPN", Width: 8, Value: tlsValue(func(info *TLSInfo) string {
+		return info.ALPN
+	})}
+	ColumnCertSubject = Column{Header: "CERT CN", Width: 24, Value: certValue(func(c *CertInfo) string {
+		return c.Subject
+	})}
+	ColumnCertSANs = Column{Header: "CERT SANS", Width: 32, Value: certValue(func(c *CertInfo) string {
+		return strings.Join(c.SANs, ",")
+	})}
+	ColumnCertIssuer = Column{Header: "ISSUER", Width: 24, Value: certValue(func(c *CertInfo) string {
+		return c.Issuer
+	})}
+	ColumnCertNotBefore = Column{Header: "NOT BEFORE", Width: 10, Value: certValue(func(c *CertInfo) string {
+		return c.NotBefore.Format(time.DateOnly)
+	})}
+	ColumnCertNotAfter = Column{Header: "NOT AFTER", Width: 10, Value: certValue(func(c *CertInfo) string {
+		return c.NotAfter.Format(time.DateOnly)
+	})}
+	ColumnCertKeyType = Column{Header: "KEY", Width: 10, Value: certValue(func(c *CertInfo) string {
+		return c.KeyType
+	})}
+	ColumnCertStatus = Column{Header: "VERIFY", Width: 13, Value: tlsValue(func(info *TLSInfo) string {
+		return string(info.Verification)
+	})}
+	ColumnCertSerial = Column{Header: "SERIAL", Width: 32, Value: certValue(func(c *CertInfo) string {
+		return c.Serial
+	})}
+)
+
+// DefaultColumns are used when a scanner does not set its own.
+var DefaultColumns = []Column{ColumnIP, ColumnTarget}
+
+// FailureColumns lay out the text failures file.
+var FailureColumns = []Column{ColumnErrorClass, ColumnTarget.Named("TARGET"), ColumnError}
+
+// FormatText renders a result as a single column-aligned line.
+func FormatText(columns []Column, r *Result) string {
+	var b strings.Builder
+	for i, col := range columns {
+		if i > 0 {
+			b.WriteString("  ")
+		}
+		value := col.Value(r)
+		if col.Width > 0 && i < len(columns)-1 {
+			fmt.Fprintf(&b, "%-*s", col.Width, value)
+		} else {
+			b.WriteString(value)
+		}
+	}
+	return strings.TrimRight(b.String(), " ")
+}
+
+// FormatHeader renders the column headers aligned like FormatText.
+func FormatHeader(columns []Column) string {
+	headers := &Result{}
+	cols := make([]Column, len(columns))
+	for i, col := range columns {
+		header := col.Header
+		cols[i] = Column{Width: col.Width, Value: func(*Result) string { return header }}
+	}
+	return FormatText(cols, headers)
+}
+
+// resultColor picks the dashboard colour of a result from its fields
+func resultColor(r *Result) string {
+	switch {
+	case r.ErrorClass != "":
+		return ColorRed
+	case r.Status == 101 || (r.Status >= 200 && r.Status < 300):
+		return ColorGreen
+	case r.Status >= 300 && r.Status < 400:
+		return ColorYellow
+	case r.Status >= 400:
+		return ColorRed
+	}
+	return ""
+}
@@ -0,0 +1,53 @@
+package queuescanner
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// IsRetryable reports whether a failed scan may succeed if repeated:
+// timeouts, connection resets and temporary DNS failures such as SERVFAIL.
+// Definitive answers, like a refused connection, NXDOMAIN, an unexpected
+// status or an invalid certificate, are never retried.
+func IsRetryable(err error) bool {
+	switch ClassifyError(err) {
+	case FailureConnectRefused, FailureUnexpectedStatus, FailureFiltered, FailureCertificate:
+		return false
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
+
+	return isCongestionError(err)
+}
+
+// retryDelay returns the backoff before the given retry, doubling each time
+func (qs *QueueScanner) retryDelay(attempt int) time.Duration {
+	return qs.retryBackoff << min(attempt, 16)
+}
+
+// retry puts item back on the queue after its backoff. The item stays
+// outstanding, so the queue is not closed while it waits.
+func (qs *QueueScanner) retry(item queueItem) {
+	atomic.AddInt64(&qs.ctx.retried, 1)
+	delay := qs.retryDelay(item.attempt)
+	item.attempt++
+
+	go func() {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+			// Workers keep draining the queue until nothing is outstanding,
+			// so this send cannot block forever
+			qs.queue <- item
+		case <-qs.ctx.Context().Done():
+			qs.outstanding.Done()
+		}
+	}()
+}
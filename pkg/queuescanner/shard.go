@@ -0,0 +1,58 @@
+package queuescanner
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// ParseShard parses a shard spec "i/n", where i counts from 1 to n.
+func ParseShard(spec string) (index, count int, err error) {
+	i, n, ok := strings.Cut(spec, "/")
+	if ok {
+		index, err = strconv.Atoi(i)
+		if err == nil {
+			count, err = strconv.Atoi(n)
+		}
+	}
+	if !ok || err != nil || count < 1 || index < 1 || index > count {
+		return 0, 0, fmt.Errorf("invalid shard %q (want i/n with 1 <= i <= n, e.g. 2/4)", spec)
+	}
+	return index, count, nil
+}
+
+// shardOf returns the shard, from 0 to count-1, a target belongs to
+func shardOf(target string, count int) int {
+	h := fnv.New64a()
+	h.Write([]byte(target))
+	return int(mix64(h.Sum64()) % uint64(count))
+}
+
+// shardSource passes on only the targets of one shard
+type shardSource struct {
+	TargetSource
+	index int // from 0
+	count int
+}
+
+func (s *shardSource) Next() (string, error) {
+	for {
+		target, err := s.TargetSource.Next()
+		if err != nil {
+			return "", err
+		}
+		if shardOf(target, s.count) == s.index {
+			return target, nil
+		}
+	}
+}
+
+// Total estimates the shard size as an even share of the whole list.
+func (s *shardSource) Total() int64 {
+	total := s.TargetSource.Total()
+	if total < 0 {
+		return -1
+	}
+	return (total + int64(s.count-1-s.index)) / int64(s.count)
+}
@@ -0,0 +1,365 @@
+package queuescanner
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+)
+
+// TargetSource yields scan targets one at a time so the queue never needs the
+// whole list in memory.
+type TargetSource interface {
+	// Next returns the next target, or io.EOF once the source is exhausted.
+	Next() (string, error)
+	// Total returns the known or estimated number of targets, or -1 if unknown.
+	Total() int64
+	// Close releases any file handle held by the source.
+	Close() error
+}
+
+// sliceSource serves targets from an in-memory list
+type sliceSource struct {
+	items []string
+	pos   int
+}
+
+// NewSliceSource returns a source over an already loaded list of targets.
+func NewSliceSource(items []string) TargetSource {
+	return &sliceSource{items: items}
+}
+
+func (s *sliceSource) Next() (string, error) {
+	if s.pos >= len(s.items) {
+		return "", io.EOF
+	}
+	item := s.items[s.pos]
+	s.pos++
+	return item, nil
+}
+
+func (s *sliceSource) Total() int64 { return int64(len(s.items)) }
+func (s *sliceSource) Close() error { return nil }
+
+// readerSource reads one target per non-empty line
+type readerSource struct {
+	scanner *bufio.Scanner
+	closer  io.Closer
+	total   int64
+}
+
+// NewReaderSource reads one target per non-empty line from r. total is the
+// expected number of targets, or -1 if unknown.
+func NewReaderSource(r io.Reader, total int64) TargetSource {
+	src := &readerSource{
+		scanner: bufio.NewScanner(r),
+		total:   total,
+	}
+	if c, ok := r.(io.Closer); ok {
+		src.closer = c
+	}
+	return src
+}
+
+func (s *readerSource) Next() (string, error) {
+	for s.scanner.Scan() {
+		if line := s.scanner.Text(); line != "" {
+			return line, nil
+		}
+	}
+	if err := s.scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", io.EOF
+}
+
+func (s *readerSource) Total() int64 { return s.total }
+
+func (s *readerSource) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+// NewFileSource streams targets from a file. The file is counted once up
+// front, without keeping any lines, so the progress bar knows the total.
+func NewFileSource(filename string) (TargetSource, error) {
+	total, err := countLines(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewReaderSource(file, total), nil
+}
+
+// NewStdinSource streams targets piped via stdin. It fails when stdin is an
+// interactive terminal, since nothing would ever arrive.
+func NewStdinSource() (TargetSource, error) {
+	stat, err := os.Stdin.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("error checking stdin: %w", err)
+	}
+
+	if (stat.Mode() & os.ModeCharDevice) != 0 {
+		return nil, fmt.Errorf("no input provided: use -f flag or pipe data via stdin")
+	}
+
+	return &readerSource{scanner: bufio.NewScanner(os.Stdin), total: -1}, nil
+}
+
+// countLines counts the non-empty lines of a file in fixed-size chunks
+func countLines(filename string) (int64, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var count int64
+	buf := make([]byte, 64*1024)
+	lineHasData := false
+
+	for {
+		n, err := file.Read(buf)
+		chunk := buf[:n]
+		for len(chunk) > 0 {
+			i := bytes.IndexByte(chunk, '\n')
+			if i < 0 {
+				lineHasData = true
+				break
+			}
+			if i > 0 || lineHasData {
+				count++
+			}
+			lineHasData = false
+			chunk = chunk[i+1:]
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	if lineHasData {
+		count++
+	}
+
+	return count, nil
+}
+
+// cidrSource generates the host addresses of a network on the fly
+type cidrSource struct {
+	ipnet  *net.IPNet
+	next   net.IP
+	single bool // /32 and /128 yield their only address
+	total  int64
+}
+
+// NewCIDRSource generates every host address of a CIDR block, skipping the
+// network and broadcast addresses, without materialising the list.
+func NewCIDRSource(cidr string) (TargetSource, error) {
+	ip, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+
+	if v4 := ip.To4(); v4 != nil {
+		ipnet.IP = ipnet.IP.To4()
+	}
+
+	ones, size := ipnet.Mask.Size()
+	hostBits := size - ones
+
+	src := &cidrSource{
+		ipnet:  ipnet,
+		next:   append(net.IP(nil), ipnet.IP...),
+		single: hostBits == 0,
+		total:  -1,
+	}
+
+	switch {
+	case src.single:
+		src.total = 1
+	case hostBits < 63:
+		src.total = int64(1)<<hostBits - 2
+		if src.total < 0 {
+			src.total = 0
+		}
+	}
+
+	if !src.single {
+		ipInc(src.next) // Skip the network address
+	}
+
+	return src, nil
+}
+
+func (s *cidrSource) Next() (string, error) {
+	if s.next == nil || !s.ipnet.Contains(s.next) {
+		return "", io.EOF
+	}
+
+	ip := append(net.IP(nil), s.next...)
+	if !ipInc(s.next) {
+		s.next = nil
+	}
+
+	// The last address of the block is the broadcast address
+	if !s.single && (s.next == nil || !s.ipnet.Contains(s.next)) {
+		return "", io.EOF
+	}
+
+	return ip.String(), nil
+}
+
+func (s *cidrSource) Total() int64 { return s.total }
+func (s *cidrSource) Close() error { return nil }
+
+// ipInc increments ip in place and reports false when it wraps around
+func ipInc(ip net.IP) bool {
+	for j := len(ip) - 1; j >= 0; j-- {
+		ip[j]++
+		if ip[j] > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// compositeSource chains several sources one after another
+type compositeSource struct {
+	sources []TargetSource
+	pos     int
+}
+
+// NewCompositeSource chains sources, draining each one before moving on.
+func NewCompositeSource(sources ...TargetSource) TargetSource {
+	return &compositeSource{sources: sources}
+}
+
+func (s *compositeSource) Next() (string, error) {
+	for s.pos < len(s.sources) {
+		target, err := s.sources[s.pos].Next()
+		if err == io.EOF {
+			s.pos++
+			continue
+		}
+		return target, err
+	}
+	return "", io.EOF
+}
+
+func (s *compositeSource) Total() int64 {
+	var total int64
+	for _, src := range s.sources {
+		n := src.Total()
+		if n < 0 {
+			return -1
+		}
+		if total > math.MaxInt64-n {
+			return -1
+		}
+		total += n
+	}
+	return total
+}
+
+func (s *compositeSource) Close() error {
+	var firstErr error
+	for _, src := range s.sources {
+		if err := src.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// mapSource rewrites each target of the wrapped source
+type mapSource struct {
+	TargetSource
+	fn func(string) string
+}
+
+// NewMapSource applies fn to every target of src.
+func NewMapSource(src TargetSource, fn func(string) string) TargetSource {
+	return &mapSource{TargetSource: src, fn: fn}
+}
+
+func (s *mapSource) Next() (string, error) {
+	target, err := s.TargetSource.Next()
+	if err != nil {
+		return "", err
+	}
+	return s.fn(target), nil
+}
+
+// productSource pairs every target of outer with every target of a fresh
+// inner source
+type productSource struct {
+	outer   TargetSource
+	inner   func() TargetSource
+	join    func(outer, inner string) string
+	current TargetSource
+	target  string
+	total   int64
+}
+
+// NewProductSource yields join(o, i) for every target o of outer and i of
+// inner, in that order. inner is called again for each target of outer, so
+// neither side is held in memory.
+func NewProductSource(outer TargetSource, inner func() TargetSource, join func(outer, inner string) string) TargetSource {
+	src := &productSource{outer: outer, inner: inner, join: join, total: -1}
+
+	first := inner()
+	n, m := outer.Total(), first.Total()
+	first.Close()
+	switch {
+	case n < 0 || m < 0:
+	case m == 0 || n <= math.MaxInt64/m:
+		src.total = n * m
+	}
+	return src
+}
+
+func (s *productSource) Next() (string, error) {
+	for {
+		if s.current == nil {
+			target, err := s.outer.Next()
+			if err != nil {
+				return "", err
+			}
+			s.target = target
+			s.current = s.inner()
+		}
+
+		item, err := s.current.Next()
+		if err == io.EOF {
+			s.current.Close()
+			s.current = nil
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return s.join(s.target, item), nil
+	}
+}
+
+func (s *productSource) Total() int64 { return s.total }
+
+func (s *productSource) Close() error {
+	if s.current != nil {
+		s.current.Close()
+	}
+	return s.outer.Close()
+}
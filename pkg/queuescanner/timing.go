@@ -0,0 +1,238 @@
+package queuescanner
+
+import (
+	"encoding/json"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// Phase is a part of a probe whose duration is tracked.
+type Phase int
+
+const (
+	PhaseTotal     Phase = iota // the whole probe, Result.Latency
+	PhaseDNS                    // resolving the host
+	PhaseConnect                // the TCP handshake
+	PhaseTLS                    // the TLS handshake
+	PhaseFirstByte              // from sending the request to the first byte of the response
+
+	numPhases
+)
+
+var phaseNames = [numPhases]string{
+	"total",
+	"dns",
+	"connect",
+	"tls",
+	"ttfb",
+}
+
+var phaseLabels = [numPhases]string{
+	"Total",
+	"DNS",
+	"Connect",
+	"TLS",
+	"TTFB",
+}
+
+// Phases lists every phase in display order.
+var Phases = []Phase{PhaseTotal, PhaseDNS, PhaseConnect, PhaseTLS, PhaseFirstByte}
+
+// String returns the machine readable name of the phase.
+func (p Phase) String() string {
+	if p < 0 || p >= numPhases {
+		return "unknown"
+	}
+	return phaseNames[p]
+}
+
+// Label returns the human readable name used in the dashboard.
+func (p Phase) Label() string {
+	if p < 0 || p >= numPhases {
+		return "Unknown"
+	}
+	return phaseLabels[p]
+}
+
+// Timing breaks a probe down into phases. A phase that did not happen, such
+// as TLS on a plain connection or DNS for an IP address, is zero.
+type Timing struct {
+	DNS       time.Duration
+	Connect   time.Duration
+	TLS       time.Duration
+	FirstByte time.Duration
+}
+
+// phase returns the duration of p, which must not be PhaseTotal
+func (t *Timing) phase(p Phase) time.Duration {
+	switch p {
+	case PhaseDNS:
+		return t.DNS
+	case PhaseConnect:
+		return t.Connect
+	case PhaseTLS:
+		return t.TLS
+	case PhaseFirstByte:
+		return t.FirstByte
+	}
+	return 0
+}
+
+// timingJSON is Timing in milliseconds
+type timingJSON struct {
+	DNS       float64 `json:"dns_ms,omitempty"`
+	Connect   float64 `json:"connect_ms,omitempty"`
+	TLS       float64 `json:"tls_ms,omitempty"`
+	FirstByte float64 `json:"ttfb_ms,omitempty"`
+}
+
+// MarshalJSON encodes the phases in milliseconds.
+func (t *Timing) MarshalJSON() ([]byte, error) {
+	return json.Marshal(timingJSON{
+		DNS:       milliseconds(t.DNS),
+		Connect:   milliseconds(t.Connect),
+		TLS:       milliseconds(t.TLS),
+		FirstByte: milliseconds(t.FirstByte),
+	})
+}
+
+// UnmarshalJSON decodes phases written by MarshalJSON.
+func (t *Timing) UnmarshalJSON(data []byte) error {
+	var v timingJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	t.DNS = fromMilliseconds(v.DNS)
+	t.Connect = fromMilliseconds(v.Connect)
+	t.TLS = fromMilliseconds(v.TLS)
+	t.FirstByte = fromMilliseconds(v.FirstByte)
+	return nil
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func fromMilliseconds(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// Stopwatch times the consecutive phases of a probe.
+type Stopwatch struct {
+	start time.Time
+	lap   time.Time
+}
+
+// NewStopwatch starts timing.
+func NewStopwatch() *Stopwatch {
+	now := time.Now()
+	return &Stopwatch{start: now, lap: now}
+}
+
+// Lap returns the time since the previous lap, or since the start.
+func (s *Stopwatch) Lap() time.Duration {
+	now := time.Now()
+	d := now.Sub(s.lap)
+	s.lap = now
+	return d
+}
+
+// Elapsed returns the time since the start.
+func (s *Stopwatch) Elapsed() time.Duration {
+	return time.Since(s.start)
+}
+
+// Percentiles summarise the durations of one phase over the probes so far
+// that got through it. PhaseTotal counts hits only.
+type Percentiles struct {
+	Count int64
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+}
+
+const (
+	// distMin is the upper bound of the first bucket of a latencyDist
+	distMin = 100 * time.Microsecond
+	// distGrowth is the ratio between consecutive bucket bounds, which sets
+	// the precision of the percentiles
+	distGrowth = 1.05
+	// distBuckets reach from distMin to about two minutes
+	distBuckets = 290
+)
+
+// distLogGrowth is ln(distGrowth), the bucket width on a log scale
+var distLogGrowth = math.Log(distGrowth)
+
+// latencyDist counts durations into exponentially growing buckets, so
+// percentiles are accurate to a few percent without keeping every sample
+type latencyDist struct {
+	counts [distBuckets]int64
+	n      int64
+}
+
+func (d *latencyDist) observe(v time.Duration) {
+	i := 0
+	if v > distMin {
+		i = min(int(math.Ceil(math.Log(float64(v)/float64(distMin))/distLogGrowth)), distBuckets-1)
+	}
+	atomic.AddInt64(&d.counts[i], 1)
+	atomic.AddInt64(&d.n, 1)
+}
+
+// bound returns the upper bound of bucket i
+func (d *latencyDist) bound(i int) time.Duration {
+	return time.Duration(float64(distMin) * math.Pow(distGrowth, float64(i)))
+}
+
+// percentiles returns the p50, p90 and p99 of the durations observed
+func (d *latencyDist) percentiles() Percentiles {
+	p := Percentiles{Count: atomic.LoadInt64(&d.n)}
+	if p.Count == 0 {
+		return p
+	}
+
+	targets := []struct {
+		q   float64
+		out *time.Duration
+	}{{0.50, &p.P50}, {0.90, &p.P90}, {0.99, &p.P99}}
+
+	var seen int64
+	next := 0
+	for i := 0; i < distBuckets && next < len(targets); i++ {
+		seen += atomic.LoadInt64(&d.counts[i])
+		for next < len(targets) && float64(seen) >= targets[next].q*float64(p.Count) {
+			*targets[next].out = d.bound(i)
+			next++
+		}
+	}
+	return p
+}
+
+// SetTiming tells ctx where the scan function records the phases of the
+// probe, so they are attached to its failure if it fails. The phases of a
+// hit are those of its Result.
+func (ctx *Ctx) SetTiming(t *Timing) {
+	ctx.timing = t
+}
+
+// observeTiming records the duration and phases of a hit
+func (ctx *Ctx) observeTiming(res *Result) {
+	if res.Latency > 0 {
+		ctx.phases[PhaseTotal].observe(res.Latency)
+	}
+	ctx.observePhases(res.Timing)
+}
+
+// observePhases records the phases a probe, hit or failure, got through
+func (ctx *Ctx) observePhases(t *Timing) {
+	if t == nil {
+		return
+	}
+	for _, phase := range Phases[1:] {
+		if d := t.phase(phase); d > 0 {
+			ctx.phases[phase].observe(d)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package queuescanner
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"time"
+)
+
+// CertStatus is the outcome of verifying the certificate of a handshake.
+type CertStatus string
+
+const (
+	CertValid        CertStatus = "valid"
+	CertSelfSigned   CertStatus = "self-signed"
+	CertExpired      CertStatus = "expired" // or not valid yet
+	CertNameMismatch CertStatus = "name-mismatch"
+	CertUntrusted    CertStatus = "untrusted"
+)
+
+// VerifyCertificate checks the chain presented in a handshake made with
+// InsecureSkipVerify against roots, or the system roots when nil, and the
+// leaf against serverName. A handshake whose chain would be rejected by a
+// regular client, e.g. one intercepted by a captive portal, is never
+// CertValid.
+func VerifyCertificate(state tls.ConnectionState, serverName string, roots *x509.CertPool) CertStatus {
+	if len(state.PeerCertificates) == 0 {
+		return CertUntrusted
+	}
+	leaf := state.PeerCertificates[0]
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   time.Now(),
+	})
+
+	var invalid x509.CertificateInvalidError
+	var unknown x509.UnknownAuthorityError
+	switch {
+	case errors.As(err, &invalid) && invalid.Reason == x509.Expired:
+		return CertExpired
+	case errors.As(err, &unknown) && isSelfSigned(leaf):
+		return CertSelfSigned
+	case err != nil:
+		return CertUntrusted
+	}
+
+	if err := leaf.VerifyHostname(serverName); err != nil {
+		return CertNameMismatch
+	}
+	return CertValid
+}
+
+// isSelfSigned reports whether cert is signed by its own key
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
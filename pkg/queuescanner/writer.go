@@ -0,0 +1,236 @@
+package queuescanner
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Output formats accepted by NewResultWriter
+const (
+	OutputText      = "text"
+	OutputJSONLines = "jsonl"
+	OutputCSV       = "csv"
+)
+
+// OutputFormats lists the supported output formats.
+var OutputFormats = []string{OutputText, OutputJSONLines, OutputCSV}
+
+// ResultWriter persists results. Writes are buffered until Flush or Close.
+type ResultWriter interface {
+	Write(res *Result) error
+	Flush() error
+	Close() error
+}
+
+// csvHeader is the fixed column set of the csv format
+var csvHeader = []string{
+	"target", "ip", "port", "status", "server", "location", "latency_ms",
+	"dns_ms", "connect_ms", "tls_ms", "ttfb_ms",
+	"tls_version", "tls_cipher", "tls_server_name", "tls_alpn",
+	"cert_subject", "cert_sans", "cert_issuer", "cert_not_before", "cert_not_after", "cert_key_type", "cert_serial", "cert_status",
+	"error_class", "fields",
+}
+
+// ValidOutputFormat reports whether format is supported.
+func ValidOutputFormat(format string) bool {
+	for _, f := range OutputFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenResultWriter opens path for appending, so a resumed scan keeps adding
+// to the same file, and returns a buffered writer in the given format.
+func OpenResultWriter(path, format string, columns []Column) (ResultWriter, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	w, err := newResultWriter(file, format, columns, stat.Size() == 0)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// NewResultWriter returns a buffered writer in the given format. Closing it
+// also closes w when w is an io.Closer.
+func NewResultWriter(w io.Writer, format string, columns []Column) (ResultWriter, error) {
+	return newResultWriter(w, format, columns, true)
+}
+
+func newResultWriter(w io.Writer, format string, columns []Column, writeHeader bool) (ResultWriter, error) {
+	base := &bufferedWriter{buf: bufio.NewWriter(w)}
+	if c, ok := w.(io.Closer); ok {
+		base.closer = c
+	}
+
+	switch format {
+	case OutputText, "":
+		return &textWriter{bufferedWriter: base, columns: columns}, nil
+	case OutputJSONLines:
+		return &jsonWriter{bufferedWriter: base, enc: json.NewEncoder(base.buf)}, nil
+	case OutputCSV:
+		cw := &csvWriter{bufferedWriter: base, csv: csv.NewWriter(base.buf)}
+		if writeHeader {
+			if err := cw.csv.Write(csvHeader); err != nil {
+				return nil, err
+			}
+		}
+		return cw, nil
+	}
+
+	return nil, fmt.Errorf("unknown output format %q (want %s)", format, strings.Join(OutputFormats, ", "))
+}
+
+// bufferedWriter holds the buffer and underlying handle shared by all formats
+type bufferedWriter struct {
+	buf    *bufio.Writer
+	closer io.Closer
+}
+
+func (w *bufferedWriter) Flush() error {
+	return w.buf.Flush()
+}
+
+func (w *bufferedWriter) Close() error {
+	err := w.buf.Flush()
+	if w.closer != nil {
+		if cerr := w.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// textWriter writes the same column layout as the dashboard, without colours
+type textWriter struct {
+	*bufferedWriter
+	columns []Column
+}
+
+func (w *textWriter) Write(res *Result) error {
+	_, err := w.buf.WriteString(FormatText(w.columns, res) + "\n")
+	return err
+}
+
+// jsonWriter writes one JSON object per line
+type jsonWriter struct {
+	*bufferedWriter
+	enc *json.Encoder
+}
+
+func (w *jsonWriter) Write(res *Result) error {
+	return w.enc.Encode(res)
+}
+
+// csvWriter writes the fixed csvHeader columns
+type csvWriter struct {
+	*bufferedWriter
+	csv *csv.Writer
+}
+
+func (w *csvWriter) Write(res *Result) error {
+	record := []string{
+		res.Target,
+		res.IP,
+		optionalInt(res.Port),
+		optionalInt(res.Status),
+		res.Server,
+		res.Location,
+		"",
+		"", "", "", "",
+		"", "", "", "",
+		"", "", "", "", "", "", "", "",
+		res.ErrorClass,
+		formatFields(res.Fields),
+	}
+	record[6] = optionalMilliseconds(res.Latency)
+	if res.Timing != nil {
+		record[7] = optionalMilliseconds(res.Timing.DNS)
+		record[8] = optionalMilliseconds(res.Timing.Connect)
+		record[9] = optionalMilliseconds(res.Timing.TLS)
+		record[10] = optionalMilliseconds(res.Timing.FirstByte)
+	}
+	if res.TLS != nil {
+		record[11] = res.TLS.Version
+		record[12] = res.TLS.CipherSuite
+		record[13] = res.TLS.ServerName
+		record[14] = res.TLS.ALPN
+		record[22] = string(res.TLS.Verification)
+	}
+	if cert := res.cert(); cert != nil {
+		record[15] = cert.Subject
+		record[16] = strings.Join(cert.SANs, " ")
+		record[17] = cert.Issuer
+		record[18] = cert.NotBefore.Format(time.RFC3339)
+		record[19] = cert.NotAfter.Format(time.RFC3339)
+		record[20] = cert.KeyType
+		record[21] = cert.Serial
+	}
+
+	return w.csv.Write(record)
+}
+
+func (w *csvWriter) Flush() error {
+	w.csv.Flush()
+	if err := w.csv.Error(); err != nil {
+		return err
+	}
+	return w.bufferedWriter.Flush()
+}
+
+func (w *csvWriter) Close() error {
+	w.csv.Flush()
+	return w.bufferedWriter.Close()
+}
+
+func optionalInt(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+func optionalMilliseconds(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 1, 64)
+}
+
+// formatFields renders extra fields as sorted key=value pairs
+func formatFields(fields map[string]string) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + fields[k]
+	}
+	return strings.Join(parts, ";")
+}